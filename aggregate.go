@@ -0,0 +1,90 @@
+package main
+
+import (
+	"fmt"
+	"sort"
+)
+
+// DedupRecords removes duplicate log entries for the same API call and returns
+// the survivors sorted by timestamp (then UUID), so float sums and all outputs
+// are reproducible. Each record's SessionStartHour is filled in.
+//
+// Records with a requestID keep the highest-cost entry per requestID (streaming
+// writes several entries per request, the last one carrying the final usage).
+// Records without one are deduped by (session, cache_read, input, output): some
+// models split one API call into multiple JSONL entries (e.g. DeepSeek:
+// thinking, text, tool_use each get a separate entry, all carrying the same
+// usage stats), and UUID dedup fails because each entry has a different UUID.
+// Deduping already-deduped records is a no-op.
+func DedupRecords(records []CostRecord) []CostRecord {
+	// Track the maximum cost record for each requestID
+	maxCostByRequestID := make(map[string]CostRecord)
+	// Track seen usage keys (for records without requestID)
+	seenUsage := make(map[string]bool)
+
+	var deduped []CostRecord
+	for _, record := range records {
+		if record.RequestID != nil {
+			if existing, seen := maxCostByRequestID[*record.RequestID]; !seen {
+				maxCostByRequestID[*record.RequestID] = record
+			} else if record.Cost > existing.Cost {
+				maxCostByRequestID[*record.RequestID] = record
+			}
+			continue
+		}
+
+		usageKey := fmt.Sprintf("%s:%d:%d:%d", record.SessionID, record.CacheReadTokens, record.InputTokens, record.OutputTokens)
+		if seenUsage[usageKey] {
+			continue
+		}
+		seenUsage[usageKey] = true
+		deduped = append(deduped, record)
+	}
+
+	// Collect records with requestID
+	for _, record := range maxCostByRequestID {
+		deduped = append(deduped, record)
+	}
+
+	// Records arrive in nondeterministic order (parallel workers, map
+	// iteration). Sort them so float sums and all outputs are reproducible.
+	sort.Slice(deduped, func(i, j int) bool {
+		if !deduped[i].FullTimestamp.Equal(deduped[j].FullTimestamp) {
+			return deduped[i].FullTimestamp.Before(deduped[j].FullTimestamp)
+		}
+		return deduped[i].UUID < deduped[j].UUID
+	})
+
+	// Attribute each record to the hour its session started. Records are
+	// in time order, so the first one seen per session is its first request.
+	sessionStartHours := make(map[string]int)
+	for i := range deduped {
+		record := &deduped[i]
+		record.SessionStartHour = record.Hour
+		if record.SessionID == "" {
+			continue
+		}
+		if hour, ok := sessionStartHours[record.SessionID]; ok {
+			record.SessionStartHour = hour
+		} else {
+			sessionStartHours[record.SessionID] = record.Hour
+		}
+	}
+
+	return deduped
+}
+
+// Aggregate accumulates records, already deduplicated by DedupRecords, into
+// per-group metrics using cfg. Returns the metrics by group key and the grand total.
+func Aggregate(records []CostRecord, cfg GroupConfig) (map[string]Metrics, Metrics) {
+	metricsByGroup := make(map[string]Metrics)
+	total := Metrics{}
+	for _, record := range records {
+		groupKey := cfg.BuildGroupKey(record)
+		m := metricsByGroup[groupKey]
+		m.AddRecord(record)
+		metricsByGroup[groupKey] = m
+		total.AddRecord(record)
+	}
+	return metricsByGroup, total
+}
@@ -0,0 +1,66 @@
+package main
+
+import (
+	"math"
+	"slices"
+	"testing"
+	"time"
+)
+
+// TestDedupRecords checks streaming entries collapse to the costliest one per
+// request ID, split entries without one collapse by usage, and the survivors
+// come back in time order with session start hours filled in
+func TestDedupRecords(t *testing.T) {
+	req1, req2 := "req_1", "req_2"
+	at := func(hour int) time.Time { return time.Date(2026, 4, 15, hour, 0, 0, 0, time.UTC) }
+	records := []CostRecord{
+		{UUID: "c", RequestID: &req2, Cost: 3, FullTimestamp: at(12), Hour: 12, SessionID: "s1"},
+		{UUID: "a1", RequestID: &req1, Cost: 1, FullTimestamp: at(9), Hour: 9, SessionID: "s1"},
+		{UUID: "a2", RequestID: &req1, Cost: 2, FullTimestamp: at(9), Hour: 9, SessionID: "s1"},
+		{UUID: "d1", SessionID: "s2", InputTokens: 10, OutputTokens: 5, Cost: 4, FullTimestamp: at(14), Hour: 14},
+		{UUID: "d2", SessionID: "s2", InputTokens: 10, OutputTokens: 5, Cost: 4, FullTimestamp: at(14), Hour: 14},
+		{UUID: "e", SessionID: "s2", InputTokens: 20, OutputTokens: 5, Cost: 5, FullTimestamp: at(16), Hour: 16},
+	}
+
+	deduped := DedupRecords(records)
+	var uuids []string
+	var startHours []int
+	for _, r := range deduped {
+		uuids = append(uuids, r.UUID)
+		startHours = append(startHours, r.SessionStartHour)
+	}
+	if want := []string{"a2", "c", "d1", "e"}; !slices.Equal(uuids, want) {
+		t.Errorf("got records %q, want %q", uuids, want)
+	}
+	if want := []int{9, 9, 14, 14}; !slices.Equal(startHours, want) {
+		t.Errorf("got session start hours %v, want %v", startHours, want)
+	}
+
+	if again := DedupRecords(deduped); len(again) != len(deduped) {
+		t.Errorf("deduping again kept %d of %d records", len(again), len(deduped))
+	}
+}
+
+// TestAggregate checks records are summed into their groups and the total
+func TestAggregate(t *testing.T) {
+	records := []CostRecord{
+		{Timestamp: "2026-04-14", PricingKey: "opus-4.8", InputTokens: 100, OutputTokens: 10, InputCost: 0.5, OutputCost: 0.25, Cost: 0.75},
+		{Timestamp: "2026-04-15", PricingKey: "opus-4.8", InputTokens: 200, CacheReadTokens: 1000, InputCost: 1, CacheReadCost: 0.5, Cost: 1.5},
+		{Timestamp: "2026-04-15", PricingKey: "sonnet", OutputTokens: 30, OutputCost: 0.45, Cost: 0.45},
+	}
+
+	byGroup, total := Aggregate(records, getGroupConfig("model"))
+	if len(byGroup) != 2 {
+		t.Fatalf("got %d groups, want 2: %v", len(byGroup), byGroup)
+	}
+	opus := byGroup["opus-4.8"]
+	if opus.Requests != 2 || opus.InputTokens != 300 || opus.OutputTokens != 10 || opus.CacheReadTokens != 1000 || math.Abs(opus.Cost-2.25) > 1e-9 {
+		t.Errorf("opus-4.8 group is %+v", opus)
+	}
+	if sonnet := byGroup["sonnet"]; sonnet.Requests != 1 || sonnet.OutputTokens != 30 || math.Abs(sonnet.Cost-0.45) > 1e-9 {
+		t.Errorf("sonnet group is %+v", sonnet)
+	}
+	if total.Requests != 3 || total.InputTokens != 300 || total.OutputTokens != 40 || math.Abs(total.Cost-2.7) > 1e-9 {
+		t.Errorf("total is %+v", total)
+	}
+}
@@ -0,0 +1,118 @@
+package main
+
+import (
+	"encoding/csv"
+	"io"
+	"slices"
+	"strconv"
+	"time"
+)
+
+// csvMetricsHeader names the metric columns of grouped csv output
+var csvMetricsHeader = []string{
+	"input_tokens", "output_tokens", "cache_read_tokens", "cache_write_tokens", "total_tokens",
+	"input_cost", "output_cost", "cache_read_cost", "cache_write_cost", "cost",
+}
+
+// csvCost formats a cost as a plain decimal number
+func csvCost(cost float64) string {
+	return strconv.FormatFloat(cost, 'f', 6, 64)
+}
+
+// csvMetrics formats metrics in csvMetricsHeader order
+func csvMetrics(m Metrics) []string {
+	return []string{
+		strconv.Itoa(m.InputTokens),
+		strconv.Itoa(m.OutputTokens),
+		strconv.Itoa(m.CacheReadTokens),
+		strconv.Itoa(m.CacheWriteTokens),
+		strconv.Itoa(m.InputTokens + m.OutputTokens + m.CacheReadTokens + m.CacheWriteTokens),
+		csvCost(m.InputCost),
+		csvCost(m.OutputCost),
+		csvCost(m.CacheReadCost),
+		csvCost(m.CacheWriteCost),
+		csvCost(m.Cost),
+	}
+}
+
+// renderCSV writes one row per group (label columns, then plain token counts
+// and decimal costs) followed by a Total row, for spreadsheets.
+func renderCSV(w io.Writer, cfg GroupConfig, keys []string, metricsByGroup map[string]Metrics) error {
+	cw := csv.NewWriter(w)
+	var header []string
+	for _, col := range cfg.LabelColumns {
+		header = append(header, columnFieldName(col))
+	}
+	if err := cw.Write(append(header, csvMetricsHeader...)); err != nil {
+		return err
+	}
+
+	total := Metrics{}
+	for _, key := range keys {
+		m := metricsByGroup[key]
+		total.Add(m)
+		if err := cw.Write(append(cfg.ParseGroupKey(key), csvMetrics(m)...)); err != nil {
+			return err
+		}
+	}
+
+	totalLabels := make([]string, len(cfg.LabelColumns))
+	totalLabels[0] = "Total"
+	if err := cw.Write(append(totalLabels, csvMetrics(total)...)); err != nil {
+		return err
+	}
+	cw.Flush()
+	return cw.Error()
+}
+
+// csvRecordsHeader names the columns of csv-records output
+var csvRecordsHeader = []string{
+	"timestamp", "model",
+	"input_tokens", "output_tokens", "cache_read_tokens", "cache_write_tokens",
+	"input_cost", "output_cost", "cache_read_cost", "cache_write_cost", "cost",
+	"cwd", "branch",
+}
+
+// renderCSVRecords writes one CSV row per deduplicated record (no aggregation)
+// with its full RFC3339 timestamp, for bucketing in external tools. With
+// includeUUID, each row also carries the record's uuid and request_id (empty
+// if the log entry had none).
+func renderCSVRecords(w io.Writer, records []CostRecord, includeUUID bool) error {
+	cw := csv.NewWriter(w)
+	header := csvRecordsHeader
+	if includeUUID {
+		header = append(slices.Clip(header), "uuid", "request_id")
+	}
+	if err := cw.Write(header); err != nil {
+		return err
+	}
+	for _, r := range records {
+		row := []string{
+			r.FullTimestamp.In(displayLocation).Format(time.RFC3339),
+			r.PricingKey,
+			strconv.Itoa(r.InputTokens),
+			strconv.Itoa(r.OutputTokens),
+			strconv.Itoa(r.CacheReadTokens),
+			strconv.Itoa(r.CacheWriteTokens),
+			csvCost(r.InputCost),
+			csvCost(r.OutputCost),
+			csvCost(r.CacheReadCost),
+			csvCost(r.CacheWriteCost),
+			csvCost(r.Cost),
+			r.Cwd,
+			r.GitBranch,
+		}
+		if includeUUID {
+			requestID := ""
+			if r.RequestID != nil {
+				requestID = *r.RequestID
+			}
+			row = append(row, r.UUID, requestID)
+		}
+		if err := cw.Write(row); err != nil {
+			return err
+		}
+	}
+	cw.Flush()
+	return cw.Error()
+}
@@ -0,0 +1,43 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"strings"
+)
+
+// gnuplotField formats a label as a single whitespace-separated gnuplot field.
+// Labels containing whitespace are double-quoted, which gnuplot treats as one column.
+func gnuplotField(label string) string {
+	if label == "" {
+		return `""`
+	}
+	if strings.ContainsAny(label, " \t\"") {
+		return `"` + strings.ReplaceAll(label, `"`, `'`) + `"`
+	}
+	return label
+}
+
+// renderGnuplot writes one row per group as a whitespace-separated data file:
+// the group labels as leading columns, then cost and total tokens. A comment
+// header names the columns, so e.g. table:day output works with
+// `plot 'data' using 1:2`.
+func renderGnuplot(w io.Writer, cfg GroupConfig, keys []string, metricsByGroup map[string]Metrics) {
+	header := []string{"#"}
+	for _, col := range cfg.LabelColumns {
+		header = append(header, columnFieldName(col))
+	}
+	header = append(header, "cost", "tokens")
+	fmt.Fprintln(w, strings.Join(header, " "))
+
+	for _, key := range keys {
+		m := metricsByGroup[key]
+		var fields []string
+		for _, label := range cfg.ParseGroupKey(key) {
+			fields = append(fields, gnuplotField(label))
+		}
+		tokens := m.InputTokens + m.OutputTokens + m.CacheReadTokens + m.CacheWriteTokens
+		fields = append(fields, fmt.Sprintf("%.6f", m.Cost), fmt.Sprintf("%d", tokens))
+		fmt.Fprintln(w, strings.Join(fields, " "))
+	}
+}
@@ -0,0 +1,26 @@
+package main
+
+import (
+	"slices"
+	"testing"
+)
+
+// TestGroupKeyRoundTrip checks that labels containing punctuation, including
+// the "|" that used to separate key parts, survive BuildGroupKey/ParseGroupKey
+func TestGroupKeyRoundTrip(t *testing.T) {
+	for _, tc := range []struct {
+		name       string
+		grouping   string
+		record     CostRecord
+		wantLabels []string
+	}{
+		{"branch with pipe", "cwd,branch", CostRecord{Cwd: "/src/app", GitBranch: "feat|pipes"}, []string{"/src/app", "feat|pipes"}},
+		{"cwd with pipe", "cwd,session", CostRecord{Cwd: "/src/a|b", SessionID: "s1"}, []string{"/src/a|b", "s1"}},
+		{"config model with comma", "day,model", CostRecord{Timestamp: "2026-04-15", PricingKey: "custom,model"}, []string{"2026-04-15", "custom,model"}},
+	} {
+		cfg := getGroupConfig(tc.grouping)
+		if labels := cfg.ParseGroupKey(cfg.BuildGroupKey(tc.record)); !slices.Equal(labels, tc.wantLabels) {
+			t.Errorf("%s: got %q, want %q", tc.name, labels, tc.wantLabels)
+		}
+	}
+}
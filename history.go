@@ -2,6 +2,9 @@ package main
 
 import (
 	"bufio"
+	"bytes"
+	"errors"
+	"fmt"
 	"os"
 	"path/filepath"
 	"strconv"
@@ -11,9 +14,16 @@ import (
 	"github.com/go-json-experiment/json"
 )
 
+// historyDirOverride replaces the XDG history directory when non-empty (-history-dir)
+var historyDirOverride string
+
 // HistoryDir returns the XDG-compliant path for history storage.
-// Uses $XDG_DATA_HOME/ccc/history/ or ~/.local/share/ccc/history/
+// Uses historyDirOverride if set, else $XDG_DATA_HOME/ccc/history/ or
+// ~/.local/share/ccc/history/
 func HistoryDir() (string, error) {
+	if historyDirOverride != "" {
+		return historyDirOverride, nil
+	}
 	dataHome := os.Getenv("XDG_DATA_HOME")
 	if dataHome == "" {
 		home, err := os.UserHomeDir()
@@ -39,28 +49,48 @@ func HistoryFilename(t time.Time) string {
 		strconv.FormatInt(endOfDay.Unix(), 10) + ".jsonl"
 }
 
+// Errors returned by ParseHistoryFilename. Callers can use errors.Is to tell
+// an unrelated file apart from a history file whose range is corrupt.
+var (
+	// ErrNotHistoryFile means the name does not follow the YYYY-MM-DD-<start>-<end>.jsonl format
+	ErrNotHistoryFile = errors.New("not a history file")
+	// ErrBadRange means the name has the history format but its epoch range is invalid
+	ErrBadRange = errors.New("bad history file range")
+)
+
 // ParseHistoryFilename extracts the time range from a history filename.
-// Returns start and end Unix timestamps, or error if parsing fails.
+// Returns start and end Unix timestamps, or an error wrapping ErrNotHistoryFile
+// or ErrBadRange if parsing fails.
 func ParseHistoryFilename(name string) (start, end int64, err error) {
 	// Strip directory and extension
 	base := filepath.Base(name)
+	if !strings.HasSuffix(base, ".jsonl") {
+		return 0, 0, fmt.Errorf("%w: %s", ErrNotHistoryFile, base)
+	}
 	base = strings.TrimSuffix(base, ".jsonl")
 
 	// Format: YYYY-MM-DD-<start>-<end>
 	// Split by "-" gives: [YYYY, MM, DD, start, end]
 	parts := strings.Split(base, "-")
-	if len(parts) < 5 {
-		return 0, 0, os.ErrInvalid
+	if len(parts) != 5 {
+		return 0, 0, fmt.Errorf("%w: %s", ErrNotHistoryFile, base)
+	}
+	if _, err := time.Parse("2006-01-02", strings.Join(parts[:3], "-")); err != nil {
+		return 0, 0, fmt.Errorf("%w: %s", ErrNotHistoryFile, base)
 	}
 
 	start, err = strconv.ParseInt(parts[3], 10, 64)
 	if err != nil {
-		return 0, 0, err
+		return 0, 0, fmt.Errorf("%w: start %q: %v", ErrBadRange, parts[3], err)
 	}
 
 	end, err = strconv.ParseInt(parts[4], 10, 64)
 	if err != nil {
-		return 0, 0, err
+		return 0, 0, fmt.Errorf("%w: end %q: %v", ErrBadRange, parts[4], err)
+	}
+
+	if end <= start {
+		return 0, 0, fmt.Errorf("%w: end %d not after start %d", ErrBadRange, end, start)
 	}
 
 	return start, end, nil
@@ -68,8 +98,14 @@ func ParseHistoryFilename(name string) (start, end int64, err error) {
 
 // FileOverlapsRange checks if a history file's time range overlaps with the query range.
 // This is an O(1) check using only the filename - no file I/O needed.
+// Files that aren't history files never overlap. A history file with a corrupt
+// range is treated as overlapping, so callers still look inside it rather than
+// silently skipping its records.
 func FileOverlapsRange(filename string, queryStart, queryEnd int64) bool {
 	fileStart, fileEnd, err := ParseHistoryFilename(filename)
+	if errors.Is(err, ErrBadRange) {
+		return true
+	}
 	if err != nil {
 		return false
 	}
@@ -88,13 +124,34 @@ func FilterFilesForRange(files []string, queryStart, queryEnd int64) []string {
 	return result
 }
 
+// HistoryFilesEndedBefore splits files into history files whose range ended
+// at or before cutoff (Unix seconds) and files whose names can't be parsed.
+// Files that are still in range are in neither list.
+func HistoryFilesEndedBefore(files []string, cutoff int64) (expired, unparseable []string) {
+	for _, f := range files {
+		_, end, err := ParseHistoryFilename(f)
+		switch {
+		case err != nil:
+			unparseable = append(unparseable, f)
+		case end <= cutoff:
+			expired = append(expired, f)
+		}
+	}
+	return expired, unparseable
+}
+
 // ListHistoryFiles returns all history JSONL files in the history directory.
 func ListHistoryFiles() ([]string, error) {
 	dir, err := HistoryDir()
 	if err != nil {
 		return nil, err
 	}
+	return ListHistoryFilesIn(dir)
+}
 
+// ListHistoryFilesIn returns all history JSONL files in dir.
+// A missing directory is not an error and yields no files.
+func ListHistoryFilesIn(dir string) ([]string, error) {
 	entries, err := os.ReadDir(dir)
 	if err != nil {
 		if os.IsNotExist(err) {
@@ -151,7 +208,8 @@ func LoadUUIDs(file string) (map[string]bool, error) {
 }
 
 // AppendRawLines appends raw JSON lines to a history file with fsync.
-// Creates the file and parent directories if they don't exist.
+// Creates the file and parent directories if they don't exist. The lines go
+// out in a single write, so concurrent appenders never interleave them.
 func AppendRawLines(file string, lines [][]byte) error {
 	if len(lines) == 0 {
 		return nil
@@ -169,13 +227,13 @@ func AppendRawLines(file string, lines [][]byte) error {
 	}
 	defer f.Close()
 
+	var buf bytes.Buffer
 	for _, line := range lines {
-		if _, err := f.Write(line); err != nil {
-			return err
-		}
-		if _, err := f.Write([]byte("\n")); err != nil {
-			return err
-		}
+		buf.Write(line)
+		buf.WriteByte('\n')
+	}
+	if _, err := f.Write(buf.Bytes()); err != nil {
+		return err
 	}
 
 	return f.Sync()
@@ -189,3 +247,233 @@ func HistoryFileForTimestamp(t time.Time) (string, error) {
 	}
 	return filepath.Join(dir, HistoryFilename(t)), nil
 }
+
+// journalName is the write-ahead journal in the history directory. It records
+// a batch of appends before they happen and is removed once all are synced,
+// so a leftover journal means the last save was interrupted.
+const journalName = "save.journal"
+
+// HistoryAppend is one file's share of a journaled history save
+type HistoryAppend struct {
+	File string `json:"file"`
+	// Offset is the file's size before the append, so recovery can cut off
+	// everything the batch wrote
+	Offset int64    `json:"offset"`
+	Lines  [][]byte `json:"-"`
+}
+
+// AppendHistoryBatch appends lines to several history files as one batch.
+// The batch (files and their sizes) is first written to the journal
+// and synced; the journal is removed only after every append has been
+// synced. If the save is interrupted, RecoverHistoryJournal truncates the
+// files back to those sizes next run, so history gains all of a batch or
+// none of it; a later run saves the records again while the session logs
+// still have them. Fails if an earlier batch's journal is still pending:
+// recover it first, or its rollback would be lost.
+func AppendHistoryBatch(appends []HistoryAppend) error {
+	if len(appends) == 0 {
+		return nil
+	}
+	dir, err := HistoryDir()
+	if err != nil {
+		return err
+	}
+	return appendHistoryBatchIn(dir, appends)
+}
+
+// appendHistoryBatchIn is AppendHistoryBatch journaling in dir
+func appendHistoryBatchIn(dir string, appends []HistoryAppend) error {
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return err
+	}
+
+	if err := writeHistoryJournal(dir, appends); err != nil {
+		return err
+	}
+
+	for _, a := range appends {
+		if err := AppendRawLines(a.File, a.Lines); err != nil {
+			// Leave the journal so the next run rolls back the partial save
+			return fmt.Errorf("appending to %s: %w", a.File, err)
+		}
+	}
+	return os.Remove(filepath.Join(dir, journalName))
+}
+
+// writeHistoryJournal records each append's file and current size in the
+// journal in dir and syncs it. It never replaces an existing journal.
+func writeHistoryJournal(dir string, appends []HistoryAppend) error {
+	for i, a := range appends {
+		info, err := os.Stat(a.File)
+		switch {
+		case err == nil:
+			appends[i].Offset = info.Size()
+		case os.IsNotExist(err):
+			appends[i].Offset = 0
+		default:
+			return err
+		}
+	}
+
+	journal := filepath.Join(dir, journalName)
+	f, err := os.OpenFile(journal, os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0644)
+	if err != nil {
+		if os.IsExist(err) {
+			return fmt.Errorf("an interrupted save's journal is still pending (%s): %w", journal, err)
+		}
+		return fmt.Errorf("creating journal: %w", err)
+	}
+	for _, a := range appends {
+		entry, err := json.Marshal(a)
+		if err != nil {
+			f.Close()
+			return err
+		}
+		if _, err := f.Write(append(entry, '\n')); err != nil {
+			f.Close()
+			return fmt.Errorf("writing journal: %w", err)
+		}
+	}
+	if err := f.Sync(); err != nil {
+		f.Close()
+		return fmt.Errorf("syncing journal: %w", err)
+	}
+	return f.Close()
+}
+
+// RecoverHistoryJournal rolls back a save interrupted after writing its
+// journal: each history file named is truncated to its size before the save,
+// and the journal is removed. Returns the number of lines dropped; no journal
+// means nothing to do.
+func RecoverHistoryJournal() (int, error) {
+	dir, err := HistoryDir()
+	if err != nil {
+		return 0, err
+	}
+	return recoverHistoryJournalIn(dir)
+}
+
+// recoverHistoryJournalIn is RecoverHistoryJournal for the journal in dir
+func recoverHistoryJournalIn(dir string) (int, error) {
+	journal := filepath.Join(dir, journalName)
+	data, err := os.ReadFile(journal)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return 0, nil
+		}
+		return 0, err
+	}
+
+	dropped := 0
+	for _, line := range bytes.Split(data, []byte("\n")) {
+		var entry HistoryAppend
+		if err := json.Unmarshal(line, &entry); err != nil || entry.File == "" {
+			continue // Torn journal line: its append never started
+		}
+		n, err := truncateHistoryFile(entry.File, entry.Offset)
+		if err != nil {
+			return dropped, fmt.Errorf("truncating %s: %w", entry.File, err)
+		}
+		dropped += n
+	}
+	return dropped, os.Remove(journal)
+}
+
+// truncateHistoryFile cuts file back to size bytes and syncs it, returning
+// the number of (possibly partial) lines removed. A missing file, or one
+// already no longer than size, is left alone.
+func truncateHistoryFile(file string, size int64) (int, error) {
+	f, err := os.OpenFile(file, os.O_RDWR, 0)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return 0, nil
+		}
+		return 0, err
+	}
+	defer f.Close()
+	info, err := f.Stat()
+	if err != nil {
+		return 0, err
+	}
+	if info.Size() <= size {
+		return 0, nil
+	}
+
+	tail := make([]byte, info.Size()-size)
+	if _, err := f.ReadAt(tail, size); err != nil {
+		return 0, err
+	}
+	lines := bytes.Count(tail, []byte("\n"))
+	if tail[len(tail)-1] != '\n' {
+		lines++
+	}
+
+	if err := f.Truncate(size); err != nil {
+		return 0, err
+	}
+	return lines, f.Sync()
+}
+
+// replaceFile atomically replaces file with data: it is written and synced to
+// a temp file in the same directory, which is then renamed over file
+func replaceFile(file string, data []byte) error {
+	tmp, err := os.CreateTemp(filepath.Dir(file), ".replace-*")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+	if err := tmp.Chmod(0644); err != nil {
+		tmp.Close()
+		return err
+	}
+	if _, err := tmp.Write(data); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Sync(); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+	return os.Rename(tmp.Name(), file)
+}
+
+// CompactHistoryFile rewrites a history file without unparseable lines or
+// lines whose UUID appeared earlier in the file, replacing it atomically if
+// anything changed. Returns the number of duplicate and corrupt lines removed.
+func CompactHistoryFile(file string) (duplicates, corrupt int, err error) {
+	data, err := os.ReadFile(file)
+	if err != nil {
+		return 0, 0, err
+	}
+
+	seen := make(map[string]bool)
+	var kept bytes.Buffer
+	for _, line := range bytes.Split(data, []byte("\n")) {
+		if len(line) == 0 {
+			continue
+		}
+		var entry struct {
+			UUID string `json:"uuid"`
+		}
+		if err := json.Unmarshal(line, &entry); err != nil {
+			corrupt++
+			continue
+		}
+		if entry.UUID != "" {
+			if seen[entry.UUID] {
+				duplicates++
+				continue
+			}
+			seen[entry.UUID] = true
+		}
+		kept.Write(line)
+		kept.WriteByte('\n')
+	}
+	if bytes.Equal(kept.Bytes(), data) {
+		return 0, 0, nil
+	}
+	return duplicates, corrupt, replaceFile(file, kept.Bytes())
+}
@@ -0,0 +1,84 @@
+package main
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+// TestRecoverHistoryJournalTornWrite simulates a save that crashes partway
+// through writing a line and checks that recovery leaves exactly the records
+// saved before it
+func TestRecoverHistoryJournalTornWrite(t *testing.T) {
+	dir := t.TempDir()
+	file := filepath.Join(dir, HistoryFilename(time.Date(2026, 4, 15, 12, 0, 0, 0, time.UTC)))
+
+	prior := []HistoryAppend{{File: file, Lines: [][]byte{[]byte(`{"uuid":"a"}`), []byte(`{"uuid":"b"}`)}}}
+	if err := appendHistoryBatchIn(dir, prior); err != nil {
+		t.Fatal(err)
+	}
+	want, err := os.ReadFile(file)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// The next save journals its batch, then dies after one and a half lines
+	if err := writeHistoryJournal(dir, []HistoryAppend{{File: file}}); err != nil {
+		t.Fatal(err)
+	}
+	f, err := os.OpenFile(file, os.O_APPEND|os.O_WRONLY, 0644)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := f.WriteString("{\"uuid\":\"c\"}\n{\"uu"); err != nil {
+		t.Fatal(err)
+	}
+	if err := f.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	dropped, err := recoverHistoryJournalIn(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if dropped != 2 {
+		t.Errorf("recovery dropped %d lines, want 2", dropped)
+	}
+	got, err := os.ReadFile(file)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(got, want) {
+		t.Errorf("history after recovery is %q, want %q", got, want)
+	}
+	if _, err := os.Stat(filepath.Join(dir, journalName)); !os.IsNotExist(err) {
+		t.Errorf("journal left behind after recovery (stat: %v)", err)
+	}
+}
+
+// TestAppendHistoryBatchPendingJournal checks a save refuses to replace the
+// journal of an earlier interrupted save, whose rollback would otherwise be lost
+func TestAppendHistoryBatchPendingJournal(t *testing.T) {
+	dir := t.TempDir()
+	file := filepath.Join(dir, HistoryFilename(time.Date(2026, 4, 15, 12, 0, 0, 0, time.UTC)))
+
+	if err := writeHistoryJournal(dir, []HistoryAppend{{File: file}}); err != nil {
+		t.Fatal(err)
+	}
+	pending, err := os.ReadFile(filepath.Join(dir, journalName))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if err := appendHistoryBatchIn(dir, []HistoryAppend{{File: file, Lines: [][]byte{[]byte(`{"uuid":"a"}`)}}}); err == nil {
+		t.Fatal("append succeeded over a pending journal")
+	}
+	if got, err := os.ReadFile(filepath.Join(dir, journalName)); err != nil || !bytes.Equal(got, pending) {
+		t.Errorf("pending journal changed: %q (err %v), want %q", got, err, pending)
+	}
+	if _, err := os.Stat(file); !os.IsNotExist(err) {
+		t.Errorf("history file written despite the pending journal (stat: %v)", err)
+	}
+}
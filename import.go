@@ -0,0 +1,129 @@
+package main
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"maps"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+
+	"github.com/go-json-experiment/json"
+)
+
+// importResult counts the outcome of importing archived JSONL into history
+type importResult struct {
+	ImportedByDate map[string]int // Lines appended per history date
+	Duplicates     int            // Lines skipped because their UUID was already in history
+}
+
+// importHistory reads every .jsonl file under dir and appends the priced
+// Claude entries to the date-bucketed history files, skipping any whose UUID
+// is already in history (or earlier in the import). Lines that aren't priced
+// usage entries are ignored, matching what the normal flow saves.
+func importHistory(dir string) (importResult, error) {
+	result := importResult{ImportedByDate: make(map[string]int)}
+
+	// UUIDs already in history
+	existing := make(map[string]bool)
+	historyFiles, err := ListHistoryFiles()
+	if err != nil {
+		return result, fmt.Errorf("listing history files: %w", err)
+	}
+	for _, f := range historyFiles {
+		ids, err := LoadUUIDs(f)
+		if err != nil {
+			return result, fmt.Errorf("loading UUIDs from %s: %w", f, err)
+		}
+		for id := range ids {
+			existing[id] = true
+		}
+	}
+
+	var files []string
+	err = filepath.WalkDir(dir, func(path string, d os.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if !d.IsDir() && strings.HasSuffix(d.Name(), ".jsonl") {
+			files = append(files, path)
+		}
+		return nil
+	})
+	if err != nil {
+		return result, err
+	}
+
+	// Collect new lines per history file
+	linesByFile := make(map[string][][]byte)
+	dateByFile := make(map[string]string)
+	for _, path := range files {
+		f, err := os.Open(path)
+		if err != nil {
+			return result, err
+		}
+		scanner := bufio.NewScanner(f)
+		scanner.Buffer(make([]byte, 1024*1024), 64*1024*1024)
+		for scanner.Scan() {
+			line := scanner.Bytes()
+			if len(line) == 0 {
+				continue
+			}
+
+			var entry ConversationEntry
+			if err := json.Unmarshal(line, &entry); err != nil {
+				continue
+			}
+			if entry.UUID == "" {
+				continue
+			}
+			if _, _, _, _, _, _, _, _, _, pricingKey := CalculateCost(&entry.Message, entry.Timestamp); pricingKey == "" {
+				continue
+			}
+			if existing[entry.UUID] {
+				result.Duplicates++
+				continue
+			}
+			existing[entry.UUID] = true
+
+			histFile, err := HistoryFileForTimestamp(entry.Timestamp.Local())
+			if err != nil {
+				f.Close()
+				return result, err
+			}
+			linesByFile[histFile] = append(linesByFile[histFile], slices.Clone(line))
+			dateByFile[histFile] = entry.Timestamp.Local().Format("2006-01-02")
+		}
+		err = scanner.Err()
+		f.Close()
+		if err != nil {
+			return result, fmt.Errorf("reading %s: %w", path, err)
+		}
+	}
+
+	var appends []HistoryAppend
+	for histFile, lines := range linesByFile {
+		appends = append(appends, HistoryAppend{File: histFile, Lines: lines})
+	}
+	if err := AppendHistoryBatch(appends); err != nil {
+		return result, fmt.Errorf("writing history: %w", err)
+	}
+	for histFile, lines := range linesByFile {
+		result.ImportedByDate[dateByFile[histFile]] += len(lines)
+	}
+
+	return result, nil
+}
+
+// printImportReport writes per-date import counts and the duplicate count
+func printImportReport(w io.Writer, result importResult) {
+	total := 0
+	for _, date := range slices.Sorted(maps.Keys(result.ImportedByDate)) {
+		n := result.ImportedByDate[date]
+		total += n
+		fmt.Fprintf(w, "%s  %d imported\n", date, n)
+	}
+	fmt.Fprintf(w, "Imported %d records, skipped %d duplicates\n", total, result.Duplicates)
+}
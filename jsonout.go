@@ -0,0 +1,124 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"strings"
+
+	"github.com/go-json-experiment/json"
+	"github.com/go-json-experiment/json/jsontext"
+)
+
+// jsonMetrics holds the token and cost fields shared by groups and the total
+type jsonMetrics struct {
+	InputTokens      int     `json:"input_tokens"`
+	OutputTokens     int     `json:"output_tokens"`
+	CacheReadTokens  int     `json:"cache_read_tokens"`
+	CacheWriteTokens int     `json:"cache_write_tokens"`
+	TotalTokens      int     `json:"total_tokens"`
+	InputCost        float64 `json:"input_cost"`
+	OutputCost       float64 `json:"output_cost"`
+	CacheReadCost    float64 `json:"cache_read_cost"`
+	CacheWriteCost   float64 `json:"cache_write_cost"`
+	Cost             float64 `json:"cost"`
+	Requests         int     `json:"requests"`
+}
+
+// jsonGroup is one group (table row) in JSON output. Key is for display
+// only: labels may themselves contain "|", so it can't be split back into
+// them. Consumers should read Labels instead.
+type jsonGroup struct {
+	Key         string            `json:"key"`    // Labels joined with "|", not parseable
+	Labels      map[string]string `json:"labels"` // Label column (e.g. "date", "model") -> value
+	jsonMetrics `json:",inline"`
+}
+
+// jsonDocument is the buffered (non-streaming) JSON output
+type jsonDocument struct {
+	Total  jsonMetrics `json:"total"` // Grand total over all groups
+	Groups []jsonGroup `json:"groups"`
+}
+
+// newJSONMetrics converts metrics to their JSON fields
+func newJSONMetrics(m Metrics) jsonMetrics {
+	return jsonMetrics{
+		InputTokens:      m.InputTokens,
+		OutputTokens:     m.OutputTokens,
+		CacheReadTokens:  m.CacheReadTokens,
+		CacheWriteTokens: m.CacheWriteTokens,
+		TotalTokens:      m.InputTokens + m.OutputTokens + m.CacheReadTokens + m.CacheWriteTokens,
+		InputCost:        m.InputCost,
+		OutputCost:       m.OutputCost,
+		CacheReadCost:    m.CacheReadCost,
+		CacheWriteCost:   m.CacheWriteCost,
+		Cost:             m.Cost,
+		Requests:         m.Requests,
+	}
+}
+
+// newJSONGroup builds the JSON object for a group key
+func newJSONGroup(cfg GroupConfig, key string, m Metrics) jsonGroup {
+	labels := make(map[string]string, len(cfg.LabelColumns))
+	for i, label := range cfg.ParseGroupKey(key) {
+		if i < len(cfg.LabelColumns) {
+			labels[columnFieldName(cfg.LabelColumns[i])] = label
+		}
+	}
+	return jsonGroup{
+		Key:         strings.ReplaceAll(key, groupKeySeparator, "|"),
+		Labels:      labels,
+		jsonMetrics: newJSONMetrics(m),
+	}
+}
+
+// renderJSON writes the grand total and all groups as a single JSON document
+func renderJSON(w io.Writer, cfg GroupConfig, keys []string, metricsByGroup map[string]Metrics) error {
+	doc := jsonDocument{Groups: make([]jsonGroup, 0, len(keys))}
+	total := Metrics{}
+	for _, key := range keys {
+		doc.Groups = append(doc.Groups, newJSONGroup(cfg, key, metricsByGroup[key]))
+		total.Add(metricsByGroup[key])
+	}
+	doc.Total = newJSONMetrics(total)
+	if err := json.MarshalWrite(w, doc, json.Deterministic(true)); err != nil {
+		return err
+	}
+	_, err := fmt.Fprintln(w)
+	return err
+}
+
+// renderJSONStream writes the same document as renderJSON, but encodes one
+// group object at a time in key order instead of building the whole output
+// in memory. The encoder inserts the separators between elements.
+func renderJSONStream(w io.Writer, cfg GroupConfig, keys []string, metricsByGroup map[string]Metrics) error {
+	total := Metrics{}
+	for _, key := range keys {
+		total.Add(metricsByGroup[key])
+	}
+
+	enc := jsontext.NewEncoder(w)
+	if err := enc.WriteToken(jsontext.BeginObject); err != nil {
+		return err
+	}
+	if err := enc.WriteToken(jsontext.String("total")); err != nil {
+		return err
+	}
+	if err := json.MarshalEncode(enc, newJSONMetrics(total), json.Deterministic(true)); err != nil {
+		return err
+	}
+	if err := enc.WriteToken(jsontext.String("groups")); err != nil {
+		return err
+	}
+	if err := enc.WriteToken(jsontext.BeginArray); err != nil {
+		return err
+	}
+	for _, key := range keys {
+		if err := json.MarshalEncode(enc, newJSONGroup(cfg, key, metricsByGroup[key]), json.Deterministic(true)); err != nil {
+			return err
+		}
+	}
+	if err := enc.WriteToken(jsontext.EndArray); err != nil {
+		return err
+	}
+	return enc.WriteToken(jsontext.EndObject)
+}
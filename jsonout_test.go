@@ -0,0 +1,30 @@
+package main
+
+import (
+	"bytes"
+	"testing"
+)
+
+// TestRenderJSONStreamMatchesBuffered checks -stream only changes how the
+// document is produced, not its shape or bytes
+func TestRenderJSONStreamMatchesBuffered(t *testing.T) {
+	metricsByGroup := map[string]Metrics{
+		joinGroupKey("2026-04-14", "opus-4.8"): {InputTokens: 100, InputCost: 0.5, Cost: 0.5, Requests: 1},
+		joinGroupKey("2026-04-15", "sonnet"):   {OutputTokens: 30, OutputCost: 0.45, Cost: 0.45, Requests: 2},
+	}
+	keys := []string{joinGroupKey("2026-04-14", "opus-4.8"), joinGroupKey("2026-04-15", "sonnet")}
+	cfg := getGroupConfig("day,model")
+
+	for _, keys := range [][]string{keys, nil} {
+		var buffered, streamed bytes.Buffer
+		if err := renderJSON(&buffered, cfg, keys, metricsByGroup); err != nil {
+			t.Fatal(err)
+		}
+		if err := renderJSONStream(&streamed, cfg, keys, metricsByGroup); err != nil {
+			t.Fatal(err)
+		}
+		if !bytes.Equal(buffered.Bytes(), streamed.Bytes()) {
+			t.Errorf("streamed output differs from buffered:\nbuffered: %s\nstreamed: %s", buffered.Bytes(), streamed.Bytes())
+		}
+	}
+}
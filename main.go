@@ -2,17 +2,27 @@ package main
 
 import (
 	"bufio"
+	"bytes"
+	"cmp"
 	"flag"
 	"fmt"
+	"io"
 	"log"
+	"maps"
+	"math"
 	"os"
 	"path/filepath"
+	"regexp"
 	"runtime"
 	"runtime/pprof"
+	"slices"
+	"sort"
+	"strconv"
 	"strings"
 	"sync"
 	"text/template"
 	"time"
+	"unicode/utf8"
 
 	"github.com/go-json-experiment/json"
 
@@ -35,31 +45,106 @@ type CostRecord struct {
 	OutputCost       float64
 	CacheReadCost    float64
 	CacheWriteCost   float64
-	PricingKey       string // Consolidated model name (opus, sonnet, sonnet-longcontext, haiku-3, etc.)
-	Timestamp        string
-	FullTimestamp    time.Time // Full timestamp for history file bucketing
-	Hour             int       // Hour of day (0-23)
-	Weekday          string    // Day of week (Mon, Tue, etc.)
-	Cwd              string    // Current working directory from the log entry
-	GitBranch        string    // Git branch from the log entry
-	SessionID        string    // Session identifier for usage dedup
-	FromHistory      bool      // True if record came from history file
-	RawLine          []byte    // Original JSON line (for saving to history)
-	Source           string    // Data source: "claude" or "opencode"
-	ProviderID       string    // Provider ID (e.g., "anthropic", "zai-coding-plan")
+	// Cache writes split by TTL; they sum to CacheWriteTokens and CacheWriteCost
+	CacheWrite5mTokens int
+	CacheWrite1hTokens int
+	CacheWrite5mCost   float64
+	CacheWrite1hCost   float64
+	PricingKey         string // Consolidated model name (opus, sonnet, sonnet-longcontext, haiku-3, etc.)
+	Timestamp          string
+	FullTimestamp      time.Time // Full timestamp for history file bucketing
+	Hour               int       // Hour of day (0-23)
+	SessionStartHour   int       // Hour of day of the session's first request (Hour if no session)
+	Weekday            string    // Day of week (Monday, Tuesday, etc.)
+	Cwd                string    // Current working directory from the log entry
+	GitBranch          string    // Git branch from the log entry
+	SessionID          string    // Session identifier for usage dedup
+	ServiceTier        string    // Usage service tier (standard, batch, etc.)
+	FromHistory        bool      // True if record came from history file
+	RawLine            []byte    // Original JSON line (for saving to history)
+	Source             string    // Data source: "claude" or "opencode"
+	ProviderID         string    // Provider ID (e.g., "anthropic", "zai-coding-plan")
+	Unpriced           bool      // Model has no known pricing, so its tokens are counted at $0
 }
 
 // Metrics holds aggregated metrics for a group
 type Metrics struct {
-	Cost             float64
-	InputTokens      int
-	OutputTokens     int
-	CacheReadTokens  int
-	CacheWriteTokens int
-	InputCost        float64
-	OutputCost       float64
-	CacheReadCost    float64
-	CacheWriteCost   float64
+	Cost             float64 `json:"cost"`
+	InputTokens      int     `json:"input_tokens"`
+	OutputTokens     int     `json:"output_tokens"`
+	CacheReadTokens  int     `json:"cache_read_tokens"`
+	CacheWriteTokens int     `json:"cache_write_tokens"`
+	InputCost        float64 `json:"input_cost"`
+	OutputCost       float64 `json:"output_cost"`
+	CacheReadCost    float64 `json:"cache_read_cost"`
+	CacheWriteCost   float64 `json:"cache_write_cost"`
+	// Cache writes split by TTL; they sum to CacheWriteTokens and CacheWriteCost
+	CacheWrite5mTokens int     `json:"cache_write_5m_tokens"`
+	CacheWrite1hTokens int     `json:"cache_write_1h_tokens"`
+	CacheWrite5mCost   float64 `json:"cache_write_5m_cost"`
+	CacheWrite1hCost   float64 `json:"cache_write_1h_cost"`
+	Requests           int     `json:"requests"`        // Number of deduplicated requests
+	LongContext        int     `json:"long_context"`    // Requests billed at the >200K long-context premium
+	FirstSeen          string  `json:"first_seen"`      // Earliest record date (YYYY-MM-DD), empty if none
+	LastSeen           string  `json:"last_seen"`       // Latest record date (YYYY-MM-DD), empty if none
+	CacheSavings       float64 `json:"cache_savings"`   // Saved by cache reads versus paying the input rate
+	UpgradeSavings     float64 `json:"upgrade_savings"` // Saved had each model been its cheaper successor
+}
+
+// addSeen widens the FirstSeen/LastSeen range to include [first, last]
+func (m *Metrics) addSeen(first, last string) {
+	if first != "" && (m.FirstSeen == "" || first < m.FirstSeen) {
+		m.FirstSeen = first
+	}
+	if last != "" && last > m.LastSeen {
+		m.LastSeen = last
+	}
+}
+
+// Add accumulates another Metrics into m
+func (m *Metrics) Add(other Metrics) {
+	m.Cost += other.Cost
+	m.InputTokens += other.InputTokens
+	m.OutputTokens += other.OutputTokens
+	m.CacheReadTokens += other.CacheReadTokens
+	m.CacheWriteTokens += other.CacheWriteTokens
+	m.InputCost += other.InputCost
+	m.OutputCost += other.OutputCost
+	m.CacheReadCost += other.CacheReadCost
+	m.CacheWriteCost += other.CacheWriteCost
+	m.CacheWrite5mTokens += other.CacheWrite5mTokens
+	m.CacheWrite1hTokens += other.CacheWrite1hTokens
+	m.CacheWrite5mCost += other.CacheWrite5mCost
+	m.CacheWrite1hCost += other.CacheWrite1hCost
+	m.Requests += other.Requests
+	m.LongContext += other.LongContext
+	m.CacheSavings += other.CacheSavings
+	m.UpgradeSavings += other.UpgradeSavings
+	m.addSeen(other.FirstSeen, other.LastSeen)
+}
+
+// AddRecord accumulates a single (deduplicated) record into m
+func (m *Metrics) AddRecord(record CostRecord) {
+	m.Cost += record.Cost
+	m.InputTokens += record.InputTokens
+	m.OutputTokens += record.OutputTokens
+	m.CacheReadTokens += record.CacheReadTokens
+	m.CacheWriteTokens += record.CacheWriteTokens
+	m.InputCost += record.InputCost
+	m.OutputCost += record.OutputCost
+	m.CacheReadCost += record.CacheReadCost
+	m.CacheWriteCost += record.CacheWriteCost
+	m.CacheWrite5mTokens += record.CacheWrite5mTokens
+	m.CacheWrite1hTokens += record.CacheWrite1hTokens
+	m.CacheWrite5mCost += record.CacheWrite5mCost
+	m.CacheWrite1hCost += record.CacheWrite1hCost
+	m.Requests++
+	if strings.HasSuffix(record.PricingKey, "-longcontext") {
+		m.LongContext++
+	}
+	m.CacheSavings += CacheReadSavings(record)
+	m.UpgradeSavings += RecordUpgradeSavings(record)
+	m.addSeen(record.Timestamp, record.Timestamp)
 }
 
 // SourceType identifies the data source
@@ -75,6 +160,13 @@ type LineWork struct {
 	Line        []byte
 	FromHistory bool
 	Source      SourceType
+	Path        string // File the line was read from
+}
+
+// LineCounts tallies total and un-parseable lines for a file
+type LineCounts struct {
+	Total   int
+	Corrupt int
 }
 
 // FileWork carries a file path with source info
@@ -102,14 +194,19 @@ type GroupConfig struct {
 type DisplayMode int
 
 const (
-	DisplayWide   DisplayMode = iota // All columns with tokens + cost
-	DisplayMedium                    // Tokens only for breakdown, tokens + cost for Total
-	DisplayNarrow                    // Just label + Total (tokens + cost)
+	DisplayWide     DisplayMode = iota // All columns with tokens + cost
+	DisplayMedium                      // Tokens only for breakdown, tokens + cost for Total
+	DisplayNarrow                      // Just label + Total (tokens + cost)
+	DisplayVertical                    // No table: one "key: value" block per group
 )
 
-// getTerminalWidth returns the terminal width, or 0 if not a terminal
-func getTerminalWidth() int {
-	width, _, err := term.GetSize(int(os.Stdout.Fd()))
+// getTerminalWidth returns the terminal width of w, or 0 if w is not a terminal
+func getTerminalWidth(w io.Writer) int {
+	f, ok := w.(*os.File)
+	if !ok {
+		return 0
+	}
+	width, _, err := term.GetSize(int(f.Fd()))
 	if err != nil {
 		return 0 // Not a terminal or error
 	}
@@ -124,28 +221,79 @@ func formatTokens(tokens int) string {
 
 	switch {
 	case tokens >= 1_000_000_000:
-		return fmt.Sprintf("%.1fb", float64(tokens)/1_000_000_000.0)
+		return fmt.Sprintf("%.*fb", tokenDecimals, float64(tokens)/1_000_000_000.0)
 	case tokens >= 1_000_000:
-		return fmt.Sprintf("%.1fm", float64(tokens)/1_000_000.0)
+		return fmt.Sprintf("%.*fm", tokenDecimals, float64(tokens)/1_000_000.0)
 	case tokens >= 1_000:
-		return fmt.Sprintf("%.1fk", float64(tokens)/1_000.0)
+		return fmt.Sprintf("%.*fk", tokenDecimals, float64(tokens)/1_000.0)
 	default:
 		return fmt.Sprintf("%d", tokens)
 	}
 }
 
+// Display currency (-currency, -rate). Costs are computed and stored in USD;
+// formatCost converts them only for display.
+var (
+	currencySymbol = "$"
+	currencyRate   = 1.0
+)
+
+// currencySymbols maps -currency codes to their symbols; other codes are
+// shown as a prefix, e.g. "CHF 12.34"
+var currencySymbols = map[string]string{"USD": "$", "EUR": "€", "GBP": "£", "JPY": "¥", "INR": "₹", "CNY": "¥"}
+
+// formatCost formats a USD cost in the display currency, e.g. "$12.34" or "€11.40"
+func formatCost(usd float64) string {
+	return fmt.Sprintf("%s%.2f", currencySymbol, usd*currencyRate)
+}
+
 // formatTokensWithCostColored combines tokens and cost with ANSI color based on intensity
 func formatTokensWithCostColored(tokens int, cost float64, tokenWidth, costWidth int, intensity float64, colorScheme string) string {
 	tokenStr := formatTokens(tokens)
-	costStr := fmt.Sprintf("$%.2f", cost)
+	costStr := formatCost(cost)
 	formatted := fmt.Sprintf("%*s  %*s", tokenWidth, tokenStr, costWidth, costStr)
 
 	if noColor {
 		return formatted
 	}
 
-	color := getColorForIntensity(intensity, colorScheme)
-	return fmt.Sprintf("\033[38;2;%d;%d;%dm%s\033[0m", color[0], color[1], color[2], formatted)
+	return colorEscape(getColorForIntensity(intensity, colorScheme)) + formatted + "\033[0m"
+}
+
+// colorEscape returns the foreground color sequence for an RGB color: 24-bit,
+// or the xterm-256 equivalent with -color256 or without truecolor support
+func colorEscape(color [3]int) string {
+	if color256 {
+		return fmt.Sprintf("\033[38;5;%dm", rgbTo256(color))
+	}
+	return fmt.Sprintf("\033[38;2;%d;%d;%dm", color[0], color[1], color[2])
+}
+
+// rgbTo256 maps an RGB color to the nearest xterm-256 color cube entry
+// (16-231). Each channel is rounded to the nearest cube level on its own, a
+// monotonic mapping, so a heatmap gradient keeps its direction per channel
+// after quantization. The gray ramp is skipped for the same reason.
+func rgbTo256(color [3]int) int {
+	levels := []int{0, 95, 135, 175, 215, 255}
+	index := 16
+	for i, weight := range []int{36, 6, 1} {
+		nearest := 0
+		for j, level := range levels {
+			if abs(color[i]-level) < abs(color[i]-levels[nearest]) {
+				nearest = j
+			}
+		}
+		index += nearest * weight
+	}
+	return index
+}
+
+// abs returns the absolute value of an int
+func abs(n int) int {
+	if n < 0 {
+		return -n
+	}
+	return n
 }
 
 // getColorForIntensity returns RGB values based on intensity (0.0-1.0) and color scheme
@@ -192,6 +340,38 @@ func getColorForIntensity(intensity float64, scheme string) [3]int {
 			b := int(60 * (1 - t))
 			return [3]int{r, g, b}
 		}
+	case "redgreen": // Main data cells with -scheme redgreen
+		// Green (40, 170, 70) → Amber (235, 180, 40) → Red (230, 50, 50)
+		if intensity < 0.5 {
+			t := intensity * 2
+			r := int(40 + (195 * t))
+			g := int(170 + (10 * t))
+			b := int(70 - (30 * t))
+			return [3]int{r, g, b}
+		} else {
+			t := (intensity - 0.5) * 2
+			r := int(235 - (5 * t))
+			g := int(180 - (130 * t))
+			b := int(40 + (10 * t))
+			return [3]int{r, g, b}
+		}
+	case "cividis": // All zones with -scheme cividis (colorblind-safe)
+		// Piecewise-linear through stops sampled from matplotlib's cividis,
+		// dark blue to yellow with no red/green contrast:
+		// 0.00 (0, 32, 77) #00204D
+		// 0.25 (65, 77, 107) #414D6B
+		// 0.50 (124, 123, 120) #7C7B78
+		// 0.75 (188, 175, 111) #BCAF6F
+		// 1.00 (255, 234, 70) #FFEA46
+		stops := [][3]float64{{0, 32, 77}, {65, 77, 107}, {124, 123, 120}, {188, 175, 111}, {255, 234, 70}}
+		segment := min(int(intensity*4), 3)
+		t := intensity*4 - float64(segment)
+		from, to := stops[segment], stops[segment+1]
+		return [3]int{
+			int(from[0] + (to[0]-from[0])*t),
+			int(from[1] + (to[1]-from[1])*t),
+			int(from[2] + (to[2]-from[2])*t),
+		}
 	case "purple": // Total row
 		// Very dim (100, 60, 100) → Medium (180, 100, 180) → BRIGHT magenta (255, 100, 255)
 		if intensity < 0.5 {
@@ -223,13 +403,20 @@ type ColumnWidths struct {
 	CacheReadCostWidth   int
 	CacheWriteTokenWidth int
 	CacheWriteCostWidth  int
+	Cache5mTokenWidth    int
+	Cache5mCostWidth     int
+	Cache1hTokenWidth    int
+	Cache1hCostWidth     int
 	TotalTokenWidth      int
 	TotalCostWidth       int
+	RequestsWidth        int
 	// Cell widths for width calculation (tokens + gap + cost)
 	InputCellWidth      int
 	OutputCellWidth     int
 	CacheReadCellWidth  int
 	CacheWriteCellWidth int
+	Cache5mCellWidth    int
+	Cache1hCellWidth    int
 	TotalCellWidth      int
 }
 
@@ -255,6 +442,14 @@ func calculateColumnWidths(metricsByGroup map[string]Metrics) ColumnWidths {
 		if cacheWriteTokenW > widths.CacheWriteTokenWidth {
 			widths.CacheWriteTokenWidth = cacheWriteTokenW
 		}
+		cache5mTokenW := len(formatTokens(m.CacheWrite5mTokens))
+		if cache5mTokenW > widths.Cache5mTokenWidth {
+			widths.Cache5mTokenWidth = cache5mTokenW
+		}
+		cache1hTokenW := len(formatTokens(m.CacheWrite1hTokens))
+		if cache1hTokenW > widths.Cache1hTokenWidth {
+			widths.Cache1hTokenWidth = cache1hTokenW
+		}
 
 		// Total tokens width
 		totalTokens := m.InputTokens + m.OutputTokens + m.CacheReadTokens + m.CacheWriteTokens
@@ -263,27 +458,40 @@ func calculateColumnWidths(metricsByGroup map[string]Metrics) ColumnWidths {
 			widths.TotalTokenWidth = totalTokenW
 		}
 
-		// Cost widths (includes $)
-		inputCostW := len(fmt.Sprintf("$%.2f", m.InputCost))
+		// Cost widths (includes the currency symbol)
+		inputCostW := utf8.RuneCountInString(formatCost(m.InputCost))
 		if inputCostW > widths.InputCostWidth {
 			widths.InputCostWidth = inputCostW
 		}
-		outputCostW := len(fmt.Sprintf("$%.2f", m.OutputCost))
+		outputCostW := utf8.RuneCountInString(formatCost(m.OutputCost))
 		if outputCostW > widths.OutputCostWidth {
 			widths.OutputCostWidth = outputCostW
 		}
-		cacheReadCostW := len(fmt.Sprintf("$%.2f", m.CacheReadCost))
+		cacheReadCostW := utf8.RuneCountInString(formatCost(m.CacheReadCost))
 		if cacheReadCostW > widths.CacheReadCostWidth {
 			widths.CacheReadCostWidth = cacheReadCostW
 		}
-		cacheWriteCostW := len(fmt.Sprintf("$%.2f", m.CacheWriteCost))
+		cacheWriteCostW := utf8.RuneCountInString(formatCost(m.CacheWriteCost))
 		if cacheWriteCostW > widths.CacheWriteCostWidth {
 			widths.CacheWriteCostWidth = cacheWriteCostW
 		}
-		totalCostW := len(fmt.Sprintf("$%.2f", m.Cost))
+		cache5mCostW := utf8.RuneCountInString(formatCost(m.CacheWrite5mCost))
+		if cache5mCostW > widths.Cache5mCostWidth {
+			widths.Cache5mCostWidth = cache5mCostW
+		}
+		cache1hCostW := utf8.RuneCountInString(formatCost(m.CacheWrite1hCost))
+		if cache1hCostW > widths.Cache1hCostWidth {
+			widths.Cache1hCostWidth = cache1hCostW
+		}
+		totalCostW := utf8.RuneCountInString(formatCost(m.Cost))
 		if totalCostW > widths.TotalCostWidth {
 			widths.TotalCostWidth = totalCostW
 		}
+
+		requestsW := len(strconv.Itoa(m.Requests))
+		if requestsW > widths.RequestsWidth {
+			widths.RequestsWidth = requestsW
+		}
 	}
 
 	// Cell widths = maxTokenWidth + 2 (gap) + maxCostWidth
@@ -292,6 +500,8 @@ func calculateColumnWidths(metricsByGroup map[string]Metrics) ColumnWidths {
 	widths.OutputCellWidth = widths.OutputTokenWidth + 2 + widths.OutputCostWidth
 	widths.CacheReadCellWidth = widths.CacheReadTokenWidth + 2 + widths.CacheReadCostWidth
 	widths.CacheWriteCellWidth = widths.CacheWriteTokenWidth + 2 + widths.CacheWriteCostWidth
+	widths.Cache5mCellWidth = widths.Cache5mTokenWidth + 2 + widths.Cache5mCostWidth
+	widths.Cache1hCellWidth = widths.Cache1hTokenWidth + 2 + widths.Cache1hCostWidth
 	widths.TotalCellWidth = widths.TotalTokenWidth + 2 + widths.TotalCostWidth
 
 	return widths
@@ -306,24 +516,32 @@ func calculateTableWidth(labelWidth int, numLabelCols int, widths ColumnWidths,
 
 	switch mode {
 	case DisplayWide:
-		// All columns
-		contentWidth = labelWidth*numLabelCols +
-			widths.InputCellWidth +
-			widths.OutputCellWidth +
-			widths.CacheReadCellWidth +
-			widths.CacheWriteCellWidth +
-			widths.TotalCellWidth
-		numCols = numLabelCols + 5 // 5 metric columns
+		// All visible breakdown columns + Total
+		cellWidths := []int{widths.InputCellWidth, widths.OutputCellWidth, widths.CacheReadCellWidth, widths.CacheWriteCellWidth,
+			widths.TotalCellWidth, widths.Cache5mCellWidth, widths.Cache1hCellWidth}
+		contentWidth = labelWidth*numLabelCols + widths.TotalCellWidth
+		numCols = numLabelCols + 1
+		for _, col := range displayedMetricColumns(mode) {
+			if !hiddenColumns[col.Name] {
+				contentWidth += cellWidths[col.Cell]
+				numCols++
+			}
+		}
+		if showRequests {
+			contentWidth += max(widths.RequestsWidth, len("Requests"))
+			numCols++
+		}
 	case DisplayMedium:
-		// Breakdown columns: tokens only; Total: cell width; NO efficiency
-		// Headers: "Input"(5), "Output"(6), "Cache Read"(10), "Cache Write"(11), "Total"(5)
-		contentWidth = labelWidth*numLabelCols +
-			max(widths.InputTokenWidth, 5) +
-			max(widths.OutputTokenWidth, 6) +
-			max(widths.CacheReadTokenWidth, 10) +
-			max(widths.CacheWriteTokenWidth, 11) +
-			max(widths.TotalCellWidth, 5)
-		numCols = numLabelCols + 5 // 5 metric columns
+		// Breakdown columns: tokens only (at least header width); Total: cell width
+		tokenWidths := []int{widths.InputTokenWidth, widths.OutputTokenWidth, widths.CacheReadTokenWidth, widths.CacheWriteTokenWidth}
+		contentWidth = labelWidth*numLabelCols + max(widths.TotalCellWidth, len("Total"))
+		numCols = numLabelCols + 1
+		for _, col := range metricColumns {
+			if !hiddenColumns[col.Name] {
+				contentWidth += max(tokenWidths[col.Cell], len(col.Header))
+				numCols++
+			}
+		}
 	case DisplayNarrow:
 		// Just label + Total cell width
 		contentWidth = labelWidth*numLabelCols +
@@ -331,10 +549,98 @@ func calculateTableWidth(labelWidth int, numLabelCols int, widths ColumnWidths,
 		numCols = numLabelCols + 1 // just Total
 	}
 
+	// Optional trailing columns (e.g. % of Total)
+	extraWidth, extraCols := extraColumnsWidth()
+	contentWidth += extraWidth
+	numCols += extraCols
+
 	// borders (numCols + 1) + padding (2 per column)
 	return contentWidth + (numCols + 1) + (numCols * 2)
 }
 
+// metricColumn is a per-type breakdown column shown before Total
+type metricColumn struct {
+	Name   string // Name used by -hide-columns and -column-order
+	Header string
+	Cell   int // Index of this column's cell in the builders' output
+}
+
+// metricColumns are the breakdown columns in display order (-column-order can
+// reorder them). Builders always return cells in input, output, cache-read,
+// cache-write order followed by the Total cell; the wide builders then add
+// the 5m and 1h cache-write cells used by -split-cache.
+var metricColumns = []metricColumn{
+	{"input", "Input", 0},
+	{"output", "Output", 1},
+	{"cache-read", "Cache Read", 2},
+	{"cache-write", "Cache Write", 3},
+}
+
+// totalCell is the index of the Total cell in the builders' output
+const totalCell = 4
+
+// splitCacheColumns replace the Cache Write column in wide mode with -split-cache
+var splitCacheColumns = []metricColumn{
+	{"cache-write", "Cache 5m", 5},
+	{"cache-write", "Cache 1h", 6},
+}
+
+// displayedMetricColumns returns the breakdown columns shown in mode: with
+// -split-cache, wide mode shows Cache 5m and Cache 1h in place of Cache Write
+func displayedMetricColumns(mode DisplayMode) []metricColumn {
+	if !splitCache || mode != DisplayWide {
+		return metricColumns
+	}
+	var cols []metricColumn
+	for _, col := range metricColumns {
+		if col.Name == "cache-write" {
+			cols = append(cols, splitCacheColumns...)
+		} else {
+			cols = append(cols, col)
+		}
+	}
+	return cols
+}
+
+// visibleMetricCells arranges builder cells in the display order for mode,
+// dropping columns hidden by -hide-columns. Total always stays last.
+func visibleMetricCells(cells []string, mode DisplayMode) []string {
+	visible := make([]string, 0, len(cells))
+	for _, col := range displayedMetricColumns(mode) {
+		if !hiddenColumns[col.Name] {
+			visible = append(visible, cells[col.Cell])
+		}
+	}
+	return append(visible, cells[totalCell])
+}
+
+// reorderMetricColumns sets the display order of metricColumns from a
+// comma-separated list of column names. Columns not listed keep their
+// relative order after the listed ones.
+func reorderMetricColumns(spec string) error {
+	var ordered []metricColumn
+	seen := make(map[string]bool)
+	for _, name := range strings.Split(spec, ",") {
+		name = strings.TrimSpace(name)
+		i := slices.IndexFunc(metricColumns, func(col metricColumn) bool { return col.Name == name })
+		if i < 0 {
+			return fmt.Errorf("unknown column %q (valid: input, output, cache-read, cache-write)", name)
+		}
+		if seen[name] {
+			return fmt.Errorf("column %q listed twice", name)
+		}
+		seen[name] = true
+		ordered = append(ordered, metricColumns[i])
+	}
+	for _, col := range metricColumns {
+		if !seen[col.Name] {
+			ordered = append(ordered, col)
+		}
+	}
+	metricColumns = ordered
+	return nil
+}
+
 // chooseDisplayMode selects the best display mode that fits the terminal width
 func chooseDisplayMode(labelWidth int, numLabelCols int, widths ColumnWidths, termWidth int) DisplayMode {
 	// Allow override for testing
@@ -354,7 +660,11 @@ func chooseDisplayMode(labelWidth int, numLabelCols int, widths ColumnWidths, te
 	if calculateTableWidth(labelWidth, numLabelCols, widths, DisplayMedium) <= termWidth {
 		return DisplayMedium
 	}
-	return DisplayNarrow
+	if calculateTableWidth(labelWidth, numLabelCols, widths, DisplayNarrow) <= termWidth {
+		return DisplayNarrow
+	}
+	// Even narrow would wrap (e.g. a very long label on a tiny terminal)
+	return DisplayVertical
 }
 
 // HeatmapData stores min/max values for calculating color intensities
@@ -367,6 +677,10 @@ type HeatmapData struct {
 	MaxCacheRead  float64
 	MinCacheWrite float64
 	MaxCacheWrite float64
+	MinCache5m    float64
+	MaxCache5m    float64
+	MinCache1h    float64
+	MaxCache1h    float64
 	MinTotal      float64
 	MaxTotal      float64
 }
@@ -380,8 +694,7 @@ func formatTokensColored(tokens int, tokenWidth int, intensity float64, colorSch
 		return formatted
 	}
 
-	color := getColorForIntensity(intensity, colorScheme)
-	return fmt.Sprintf("\033[38;2;%d;%d;%dm%s\033[0m", color[0], color[1], color[2], formatted)
+	return colorEscape(getColorForIntensity(intensity, colorScheme)) + formatted + "\033[0m"
 }
 
 // buildMetricsColumnsColored creates colored token and cost columns based on heatmap
@@ -393,6 +706,8 @@ func buildMetricsColumnsColored(m Metrics, widths ColumnWidths, heatmap HeatmapD
 	outputIntensity := calculateIntensity(m.OutputCost, heatmap.MinOutput, heatmap.MaxOutput)
 	cacheReadIntensity := calculateIntensity(m.CacheReadCost, heatmap.MinCacheRead, heatmap.MaxCacheRead)
 	cacheWriteIntensity := calculateIntensity(m.CacheWriteCost, heatmap.MinCacheWrite, heatmap.MaxCacheWrite)
+	cache5mIntensity := calculateIntensity(m.CacheWrite5mCost, heatmap.MinCache5m, heatmap.MaxCache5m)
+	cache1hIntensity := calculateIntensity(m.CacheWrite1hCost, heatmap.MinCache1h, heatmap.MaxCache1h)
 	totalIntensity := calculateIntensity(m.Cost, heatmap.MinTotal, heatmap.MaxTotal)
 
 	return []string{
@@ -401,6 +716,8 @@ func buildMetricsColumnsColored(m Metrics, widths ColumnWidths, heatmap HeatmapD
 		formatTokensWithCostColored(m.CacheReadTokens, m.CacheReadCost, widths.CacheReadTokenWidth, widths.CacheReadCostWidth, cacheReadIntensity, colorScheme),
 		formatTokensWithCostColored(m.CacheWriteTokens, m.CacheWriteCost, widths.CacheWriteTokenWidth, widths.CacheWriteCostWidth, cacheWriteIntensity, colorScheme),
 		formatTokensWithCostColored(totalTokens, m.Cost, widths.TotalTokenWidth, widths.TotalCostWidth, totalIntensity, colorScheme),
+		formatTokensWithCostColored(m.CacheWrite5mTokens, m.CacheWrite5mCost, widths.Cache5mTokenWidth, widths.Cache5mCostWidth, cache5mIntensity, colorScheme),
+		formatTokensWithCostColored(m.CacheWrite1hTokens, m.CacheWrite1hCost, widths.Cache1hTokenWidth, widths.Cache1hCostWidth, cache1hIntensity, colorScheme),
 	}
 }
 
@@ -413,16 +730,20 @@ func buildMetricsColumnsWithMixedHeatmap(m Metrics, widths ColumnWidths, mainHea
 	outputIntensity := calculateIntensity(m.OutputCost, mainHeatmap.MinOutput, mainHeatmap.MaxOutput)
 	cacheReadIntensity := calculateIntensity(m.CacheReadCost, mainHeatmap.MinCacheRead, mainHeatmap.MaxCacheRead)
 	cacheWriteIntensity := calculateIntensity(m.CacheWriteCost, mainHeatmap.MinCacheWrite, mainHeatmap.MaxCacheWrite)
+	cache5mIntensity := calculateIntensity(m.CacheWrite5mCost, mainHeatmap.MinCache5m, mainHeatmap.MaxCache5m)
+	cache1hIntensity := calculateIntensity(m.CacheWrite1hCost, mainHeatmap.MinCache1h, mainHeatmap.MaxCache1h)
 
 	// Calculate intensity using total column heatmap (orange) for Total column
 	totalIntensity := calculateIntensity(m.Cost, totalColumnHeatmap.MinTotal, totalColumnHeatmap.MaxTotal)
 
 	return []string{
-		formatTokensWithCostColored(m.InputTokens, m.InputCost, widths.InputTokenWidth, widths.InputCostWidth, inputIntensity, "blue"),
-		formatTokensWithCostColored(m.OutputTokens, m.OutputCost, widths.OutputTokenWidth, widths.OutputCostWidth, outputIntensity, "blue"),
-		formatTokensWithCostColored(m.CacheReadTokens, m.CacheReadCost, widths.CacheReadTokenWidth, widths.CacheReadCostWidth, cacheReadIntensity, "blue"),
-		formatTokensWithCostColored(m.CacheWriteTokens, m.CacheWriteCost, widths.CacheWriteTokenWidth, widths.CacheWriteCostWidth, cacheWriteIntensity, "blue"),
-		formatTokensWithCostColored(totalTokens, m.Cost, widths.TotalTokenWidth, widths.TotalCostWidth, totalIntensity, "orange"),
+		formatTokensWithCostColored(m.InputTokens, m.InputCost, widths.InputTokenWidth, widths.InputCostWidth, inputIntensity, dataScheme),
+		formatTokensWithCostColored(m.OutputTokens, m.OutputCost, widths.OutputTokenWidth, widths.OutputCostWidth, outputIntensity, dataScheme),
+		formatTokensWithCostColored(m.CacheReadTokens, m.CacheReadCost, widths.CacheReadTokenWidth, widths.CacheReadCostWidth, cacheReadIntensity, dataScheme),
+		formatTokensWithCostColored(m.CacheWriteTokens, m.CacheWriteCost, widths.CacheWriteTokenWidth, widths.CacheWriteCostWidth, cacheWriteIntensity, dataScheme),
+		formatTokensWithCostColored(totalTokens, m.Cost, widths.TotalTokenWidth, widths.TotalCostWidth, totalIntensity, totalColumnScheme),
+		formatTokensWithCostColored(m.CacheWrite5mTokens, m.CacheWrite5mCost, widths.Cache5mTokenWidth, widths.Cache5mCostWidth, cache5mIntensity, dataScheme),
+		formatTokensWithCostColored(m.CacheWrite1hTokens, m.CacheWrite1hCost, widths.Cache1hTokenWidth, widths.Cache1hCostWidth, cache1hIntensity, dataScheme),
 	}
 }
 
@@ -438,12 +759,51 @@ func buildMetricsColumnsMedium(m Metrics, widths ColumnWidths, mainHeatmap Heatm
 	totalIntensity := calculateIntensity(m.Cost, totalColumnHeatmap.MinTotal, totalColumnHeatmap.MaxTotal)
 
 	return []string{
-		formatTokensColored(m.InputTokens, widths.InputTokenWidth, inputIntensity, "blue"),
-		formatTokensColored(m.OutputTokens, widths.OutputTokenWidth, outputIntensity, "blue"),
-		formatTokensColored(m.CacheReadTokens, widths.CacheReadTokenWidth, cacheReadIntensity, "blue"),
-		formatTokensColored(m.CacheWriteTokens, widths.CacheWriteTokenWidth, cacheWriteIntensity, "blue"),
-		formatTokensWithCostColored(totalTokens, m.Cost, widths.TotalTokenWidth, widths.TotalCostWidth, totalIntensity, "orange"),
+		formatTokensColored(m.InputTokens, widths.InputTokenWidth, inputIntensity, dataScheme),
+		formatTokensColored(m.OutputTokens, widths.OutputTokenWidth, outputIntensity, dataScheme),
+		formatTokensColored(m.CacheReadTokens, widths.CacheReadTokenWidth, cacheReadIntensity, dataScheme),
+		formatTokensColored(m.CacheWriteTokens, widths.CacheWriteTokenWidth, cacheWriteIntensity, dataScheme),
+		formatTokensWithCostColored(totalTokens, m.Cost, widths.TotalTokenWidth, widths.TotalCostWidth, totalIntensity, totalColumnScheme),
+	}
+}
+
+// buildRowColumns builds the metric cells for a data or subtotal row in the
+// given display mode, plus any optional columns enabled by flags
+func buildRowColumns(m Metrics, widths ColumnWidths, mode DisplayMode, mainHeatmap HeatmapData, totalColumnHeatmap HeatmapData, totalMetrics Metrics) []string {
+	var cols []string
+	switch mode {
+	case DisplayWide:
+		cols = visibleMetricCells(buildMetricsColumnsWithMixedHeatmap(m, widths, mainHeatmap, totalColumnHeatmap), mode)
+	case DisplayMedium:
+		cols = visibleMetricCells(buildMetricsColumnsMedium(m, widths, mainHeatmap, totalColumnHeatmap), mode)
+	case DisplayNarrow:
+		cols = buildMetricsColumnsNarrow(m, widths, totalColumnHeatmap)
+	}
+	cols = append(buildRequestsColumn(m, widths, mode), cols...)
+	return append(cols, buildExtraColumns(m, totalMetrics)...)
+}
+
+// buildFooterColumns builds the metric cells for the grand total footer row
+func buildFooterColumns(totalMetrics Metrics, widths ColumnWidths, mode DisplayMode, totalRowHeatmap HeatmapData) []string {
+	var cols []string
+	switch mode {
+	case DisplayWide:
+		cols = visibleMetricCells(buildMetricsColumnsColored(totalMetrics, widths, totalRowHeatmap, totalRowScheme), mode)
+	case DisplayMedium:
+		cols = visibleMetricCells(buildMetricsColumnsMedium(totalMetrics, widths, totalRowHeatmap, totalRowHeatmap), mode)
+	case DisplayNarrow:
+		cols = buildMetricsColumnsNarrow(totalMetrics, widths, totalRowHeatmap)
+	}
+	cols = append(buildRequestsColumn(totalMetrics, widths, mode), cols...)
+	return append(cols, buildExtraColumns(totalMetrics, totalMetrics)...)
+}
+
+// buildRequestsColumn returns the Requests cell, shown only in wide mode with -show-requests
+func buildRequestsColumn(m Metrics, widths ColumnWidths, mode DisplayMode) []string {
+	if !showRequests || mode != DisplayWide {
+		return nil
 	}
+	return []string{fmt.Sprintf("%*d", widths.RequestsWidth, m.Requests)}
 }
 
 // buildMetricsColumnsNarrow creates columns for narrow mode: just Total (tokens + cost)
@@ -452,11 +812,142 @@ func buildMetricsColumnsNarrow(m Metrics, widths ColumnWidths, totalColumnHeatma
 	totalIntensity := calculateIntensity(m.Cost, totalColumnHeatmap.MinTotal, totalColumnHeatmap.MaxTotal)
 
 	return []string{
-		formatTokensWithCostColored(totalTokens, m.Cost, widths.TotalTokenWidth, widths.TotalCostWidth, totalIntensity, "orange"),
+		formatTokensWithCostColored(totalTokens, m.Cost, widths.TotalTokenWidth, widths.TotalCostWidth, totalIntensity, totalColumnScheme),
+	}
+}
+
+// formatPct formats cost as a percentage of total (e.g. "12.3%")
+func formatPct(cost, total float64) string {
+	if total == 0 {
+		return "0.0%"
+	}
+	return fmt.Sprintf("%.1f%%", cost/total*100)
+}
+
+// formatSeen formats a FirstSeen/LastSeen date, "-" for groups with no records
+func formatSeen(date string) string {
+	if date == "" {
+		return "-"
+	}
+	return date
+}
+
+// formatCacheBreakeven formats the breakeven cache reads for a model group key
+// (a pricing key), or "-" for models without known pricing
+func formatCacheBreakeven(pricingKey string) string {
+	pricing, ok := modelPricing[pricingKey]
+	if !ok {
+		return "-"
+	}
+	reads, ok := pricing.CacheBreakevenReads()
+	if !ok {
+		return "never"
+	}
+	return fmt.Sprintf("%.2f", reads)
+}
+
+// barWidth is the width in cells of a -bars bar
+const barWidth = 12
+
+// formatBar renders a horizontal bar for cost scaled to maxCost. Uses eighth-block
+// characters for sub-cell precision, or '#' cells when color is off.
+func formatBar(cost, maxCost float64) string {
+	fraction := calculateIntensity(cost, 0, maxCost)
+	if noColor {
+		n := int(math.Round(fraction * barWidth))
+		return strings.Repeat("#", n) + strings.Repeat(" ", barWidth-n)
+	}
+
+	eighths := int(math.Round(fraction * barWidth * 8))
+	bar := strings.Repeat("█", eighths/8)
+	if partial := eighths % 8; partial > 0 {
+		bar += string([]rune("▏▎▍▌▋▊▉")[partial-1])
+	}
+	return bar + strings.Repeat(" ", barWidth-utf8.RuneCountInString(bar))
+}
+
+// extraHeaders returns headers for the optional trailing columns enabled by flags
+func extraHeaders() []string {
+	var headers []string
+	if showPct {
+		headers = append(headers, "% of Total")
+	}
+	if showDates {
+		headers = append(headers, "First", "Last")
+	}
+	if showSavings {
+		headers = append(headers, "Saved")
+	}
+	if cacheBreakeven {
+		headers = append(headers, "Breakeven Reads")
 	}
+	if showBars {
+		headers = append(headers, "Cost Bar")
+	}
+	if cumulative {
+		headers = append(headers, "Cumulative")
+	}
+	if relativeTo != "" {
+		headers = append(headers, "vs Baseline")
+	}
+	return headers
+}
+
+// extraColumnsWidth returns the content width and count of the optional trailing columns
+func extraColumnsWidth() (int, int) {
+	width, cols := 0, 0
+	if showPct {
+		width += len("% of Total")
+		cols++
+	}
+	if showDates {
+		width += 2 * len("2006-01-02")
+		cols += 2
+	}
+	if showSavings {
+		width += len("$0000.00")
+		cols++
+	}
+	if cacheBreakeven {
+		width += len("Breakeven Reads")
+		cols++
+	}
+	if showBars {
+		width += barWidth
+		cols++
+	}
+	if cumulative {
+		width += len("Cumulative")
+		cols++
+	}
+	if relativeTo != "" {
+		width += len("vs Baseline")
+		cols++
+	}
+	return width, cols
+}
+
+// buildExtraColumns builds the optional trailing columns for a row.
+// totalMetrics is the grand total, used for percentage-of-total.
+func buildExtraColumns(m Metrics, totalMetrics Metrics) []string {
+	var cols []string
+	if showPct {
+		cols = append(cols, formatPct(m.Cost, totalMetrics.Cost))
+	}
+	if showDates {
+		cols = append(cols, formatSeen(m.FirstSeen), formatSeen(m.LastSeen))
+	}
+	if showSavings {
+		cols = append(cols, formatCost(m.CacheSavings))
+	}
+	return cols
 }
 
-// calculateIntensity returns a value between 0.0 and 1.0 based on position between min and max
+// colorGamma is applied to heatmap intensities (-gamma); 1.0 keeps the linear mapping
+var colorGamma = 1.0
+
+// calculateIntensity returns a value between 0.0 and 1.0 based on position between min and max,
+// with -gamma applied
 func calculateIntensity(value, min, max float64) float64 {
 	if max == min {
 		return 0.0
@@ -468,6 +959,9 @@ func calculateIntensity(value, min, max float64) float64 {
 	if intensity > 1 {
 		return 1.0
 	}
+	if colorGamma != 1.0 {
+		intensity = math.Pow(intensity, colorGamma)
+	}
 	return intensity
 }
 
@@ -486,6 +980,10 @@ func calculateHeatmapData(metrics []Metrics) HeatmapData {
 		MaxCacheRead:  metrics[0].CacheReadCost,
 		MinCacheWrite: metrics[0].CacheWriteCost,
 		MaxCacheWrite: metrics[0].CacheWriteCost,
+		MinCache5m:    metrics[0].CacheWrite5mCost,
+		MaxCache5m:    metrics[0].CacheWrite5mCost,
+		MinCache1h:    metrics[0].CacheWrite1hCost,
+		MaxCache1h:    metrics[0].CacheWrite1hCost,
 		MinTotal:      metrics[0].Cost,
 		MaxTotal:      metrics[0].Cost,
 	}
@@ -519,6 +1017,19 @@ func calculateHeatmapData(metrics []Metrics) HeatmapData {
 		if m.CacheWriteCost > heatmap.MaxCacheWrite {
 			heatmap.MaxCacheWrite = m.CacheWriteCost
 		}
+		// Cache Write split by TTL (-split-cache)
+		if m.CacheWrite5mCost < heatmap.MinCache5m {
+			heatmap.MinCache5m = m.CacheWrite5mCost
+		}
+		if m.CacheWrite5mCost > heatmap.MaxCache5m {
+			heatmap.MaxCache5m = m.CacheWrite5mCost
+		}
+		if m.CacheWrite1hCost < heatmap.MinCache1h {
+			heatmap.MinCache1h = m.CacheWrite1hCost
+		}
+		if m.CacheWrite1hCost > heatmap.MaxCache1h {
+			heatmap.MaxCache1h = m.CacheWrite1hCost
+		}
 		// Total
 		if m.Cost < heatmap.MinTotal {
 			heatmap.MinTotal = m.Cost
@@ -531,6 +1042,92 @@ func calculateHeatmapData(metrics []Metrics) HeatmapData {
 	return heatmap
 }
 
+// withWeekdayColumn prepends a Day column (Mon, Tue, ...) to the day
+// grouping's labels. Grouping is unchanged: keys are still dates.
+func withWeekdayColumn(cfg GroupConfig) GroupConfig {
+	parse := cfg.ParseGroupKey
+	cfg.LabelColumns = append([]string{"Day"}, cfg.LabelColumns...)
+	cfg.ParseGroupKey = func(key string) []string {
+		return append([]string{dayKeyWeekday(key)}, parse(key)...)
+	}
+	return cfg
+}
+
+// parseDayKey parses a day grouping key: a date, or a range from
+// -merge-similar-rows (see dayRangeLabel). For a single date, end == start.
+func parseDayKey(key string) (start, end time.Time, ok bool) {
+	if len(key) < len("2006-01-02") {
+		return start, end, false
+	}
+	start, err := time.Parse("2006-01-02", key[:10])
+	if err != nil {
+		return start, end, false
+	}
+	rest, isRange := strings.CutPrefix(key[10:], "–")
+	if !isRange || len(rest) > 10 {
+		return start, start, true
+	}
+	// The range end omits the year and month it shares with the start
+	end, err = time.Parse("2006-01-02", key[:10-len(rest)]+rest)
+	if err != nil {
+		return start, start, true
+	}
+	return start, end, true
+}
+
+// dayKeyWeekday returns the abbreviated weekday of a day grouping key, or a
+// "Mon–Wed" span for ranges from -merge-similar-rows. Other keys get "".
+func dayKeyWeekday(key string) string {
+	start, end, ok := parseDayKey(key)
+	switch {
+	case !ok:
+		return ""
+	case start.Equal(end):
+		return start.Format("Mon")
+	default:
+		return start.Format("Mon") + "–" + end.Format("Mon")
+	}
+}
+
+// withElapsedColumn appends an Elapsed column ("today", "3d ago") to the day
+// grouping's labels, counted in whole days from now. Ranges from
+// -merge-similar-rows count from their last day.
+func withElapsedColumn(cfg GroupConfig, now time.Time) GroupConfig {
+	parse := cfg.ParseGroupKey
+	today := time.Date(now.Year(), now.Month(), now.Day(), 0, 0, 0, 0, time.UTC)
+	cfg.LabelColumns = append(slices.Clone(cfg.LabelColumns), "Elapsed")
+	cfg.ParseGroupKey = func(key string) []string {
+		elapsed := ""
+		if _, end, ok := parseDayKey(key); ok {
+			switch days := int(today.Sub(end).Hours() / 24); {
+			case days == 0:
+				elapsed = "today"
+			case days < 0:
+				elapsed = fmt.Sprintf("in %dd", -days)
+			default:
+				elapsed = fmt.Sprintf("%dd ago", days)
+			}
+		}
+		return append(parse(key), elapsed)
+	}
+	return cfg
+}
+
+// groupKeySeparator joins the labels of composite group keys. It's the ASCII
+// unit separator, which can't appear in paths, branches or model names, so
+// labels containing "|" or other punctuation round-trip intact.
+const groupKeySeparator = "\x1f"
+
+// joinGroupKey builds a composite group key from its labels
+func joinGroupKey(labels ...string) string {
+	return strings.Join(labels, groupKeySeparator)
+}
+
+// splitGroupKey splits a composite group key into its labels
+func splitGroupKey(key string) []string {
+	return strings.Split(key, groupKeySeparator)
+}
+
 // getGroupConfig returns the GroupConfig for a given groupBy mode
 func getGroupConfig(groupBy string) GroupConfig {
 	configs := map[string]GroupConfig{
@@ -557,10 +1154,24 @@ func getGroupConfig(groupBy string) GroupConfig {
 		"day,model": {
 			LabelColumns: []string{"Date", "Model"},
 			BuildGroupKey: func(record CostRecord) string {
-				return record.Timestamp + "|" + record.PricingKey
+				return joinGroupKey(record.Timestamp, record.PricingKey)
+			},
+			ParseGroupKey: func(key string) []string {
+				return splitGroupKey(key)
+			},
+			Hierarchical: true,
+		},
+		"day,model,branch": {
+			LabelColumns: []string{"Date", "Model", "Branch"},
+			BuildGroupKey: func(record CostRecord) string {
+				branch := record.GitBranch
+				if branch == "" {
+					branch = "(none)"
+				}
+				return joinGroupKey(record.Timestamp, record.PricingKey, branch)
 			},
 			ParseGroupKey: func(key string) []string {
-				return strings.Split(key, "|")
+				return splitGroupKey(key)
 			},
 			Hierarchical: true,
 		},
@@ -574,18 +1185,45 @@ func getGroupConfig(groupBy string) GroupConfig {
 			},
 			Hierarchical: false,
 		},
+		"fiscal-week": {
+			LabelColumns: []string{"Fiscal Week"},
+			BuildGroupKey: func(record CostRecord) string {
+				return fiscalWeekLabel(fiscalWeekIndex(record.Timestamp))
+			},
+			ParseGroupKey: func(key string) []string {
+				return []string{key}
+			},
+			SortKey: func(key string) string {
+				// Labels like FY-W-02, FY-W01, FY-W102 don't sort as strings
+				return fmt.Sprintf("%012d", int64(parseFiscalWeekLabel(key))+1<<32)
+			},
+			Hierarchical: false,
+		},
+		"session-hour": {
+			LabelColumns: []string{"Session Start"},
+			BuildGroupKey: func(record CostRecord) string {
+				return fmt.Sprintf("%02d:00", record.SessionStartHour)
+			},
+			ParseGroupKey: func(key string) []string {
+				return []string{key}
+			},
+			Hierarchical: false,
+		},
 		"weekday": {
 			LabelColumns: []string{"Day"},
 			BuildGroupKey: func(record CostRecord) string {
 				return record.Weekday
 			},
 			ParseGroupKey: func(key string) []string {
+				// Keys hold the full name; abbreviate for display unless -weekday-full
+				if !weekdayFull && len(key) > 3 && key != otherGroupLabel {
+					return []string{key[:3]}
+				}
 				return []string{key}
 			},
 			SortKey: func(key string) string {
 				// Sort weekdays in calendar order (Mon=1, Tue=2, ..., Sun=7)
-				order := map[string]string{"Mon": "1", "Tue": "2", "Wed": "3", "Thu": "4", "Fri": "5", "Sat": "6", "Sun": "7"}
-				if o, ok := order[key]; ok {
+				if o, ok := weekdayOrder[key]; ok {
 					return o
 				}
 				return key
@@ -616,13 +1254,67 @@ func getGroupConfig(groupBy string) GroupConfig {
 				if branch == "" {
 					branch = "(none)"
 				}
-				return cwd + "|" + branch
+				return joinGroupKey(cwd, branch)
+			},
+			ParseGroupKey: func(key string) []string {
+				return splitGroupKey(key)
+			},
+			Hierarchical: true,
+		},
+		"cwd,session": {
+			LabelColumns: []string{"Directory", "Session"},
+			BuildGroupKey: func(record CostRecord) string {
+				cwd := record.Cwd
+				if cwd == "" {
+					cwd = "(unknown)"
+				}
+				session := record.SessionID
+				if session == "" {
+					session = "(none)"
+				}
+				return joinGroupKey(cwd, session)
 			},
 			ParseGroupKey: func(key string) []string {
-				return strings.Split(key, "|")
+				return splitGroupKey(key)
 			},
 			Hierarchical: true,
 		},
+		"session": {
+			LabelColumns: []string{"Session"},
+			BuildGroupKey: func(record CostRecord) string {
+				if record.SessionID == "" {
+					return "(none)"
+				}
+				return record.SessionID
+			},
+			ParseGroupKey: func(key string) []string {
+				// The key keeps the full UUID so sessions never collide; only
+				// the displayed label is shortened
+				if len(key) > 8 && key != otherGroupLabel {
+					return []string{key[:8]}
+				}
+				return []string{key}
+			},
+			Hierarchical: false,
+		},
+		"branch-prefix": {
+			LabelColumns: []string{"Branch Prefix"},
+			BuildGroupKey: func(record CostRecord) string {
+				// Group by the namespace before the first "/" (feat/x -> feat)
+				if record.GitBranch == "" {
+					return "(none)"
+				}
+				prefix, _, found := strings.Cut(record.GitBranch, "/")
+				if !found || prefix == "" {
+					return "(no-prefix)"
+				}
+				return prefix
+			},
+			ParseGroupKey: func(key string) []string {
+				return []string{key}
+			},
+			Hierarchical: false,
+		},
 		"source": {
 			LabelColumns: []string{"Source"},
 			BuildGroupKey: func(record CostRecord) string {
@@ -656,13 +1348,43 @@ func getGroupConfig(groupBy string) GroupConfig {
 				if source == "" {
 					source = "claude"
 				}
-				return source + "|" + record.PricingKey
+				return joinGroupKey(source, record.PricingKey)
+			},
+			ParseGroupKey: func(key string) []string {
+				return splitGroupKey(key)
+			},
+			Hierarchical: true,
+		},
+		"model,tier": {
+			LabelColumns: []string{"Model", "Tier"},
+			BuildGroupKey: func(record CostRecord) string {
+				tier := record.ServiceTier
+				if tier == "" {
+					tier = "(standard)"
+				}
+				return joinGroupKey(record.PricingKey, tier)
 			},
 			ParseGroupKey: func(key string) []string {
-				return strings.Split(key, "|")
+				return splitGroupKey(key)
 			},
 			Hierarchical: true,
 		},
+		"week": {
+			LabelColumns: []string{"Week"},
+			BuildGroupKey: func(record CostRecord) string {
+				// ISO week of the record's (display-timezone) day, "2006-W01"
+				day, err := time.Parse("2006-01-02", record.Timestamp)
+				if err != nil {
+					return "(unknown)"
+				}
+				year, week := day.ISOWeek()
+				return fmt.Sprintf("%04d-W%02d", year, week)
+			},
+			ParseGroupKey: func(key string) []string {
+				return []string{key}
+			},
+			Hierarchical: false,
+		},
 		"month": {
 			LabelColumns: []string{"Month"},
 			BuildGroupKey: func(record CostRecord) string {
@@ -676,10 +1398,10 @@ func getGroupConfig(groupBy string) GroupConfig {
 		"month,model": {
 			LabelColumns: []string{"Month", "Model"},
 			BuildGroupKey: func(record CostRecord) string {
-				return record.Timestamp[:7] + "|" + record.PricingKey
+				return joinGroupKey(record.Timestamp[:7], record.PricingKey)
 			},
 			ParseGroupKey: func(key string) []string {
-				return strings.Split(key, "|")
+				return splitGroupKey(key)
 			},
 			Hierarchical: true,
 		},
@@ -688,25 +1410,204 @@ func getGroupConfig(groupBy string) GroupConfig {
 	if cfg, ok := configs[groupBy]; ok {
 		return cfg
 	}
+	if cfg, ok := comboGroupConfig(groupBy); ok {
+		return cfg
+	}
 	// Default to "day"
 	return configs["day"]
 }
 
-// parseOutputFormat parses the unified -output flag value
-// Returns: outputKind ("table" or "summary"), groupBy string, template string
-func parseOutputFormat(format string) (string, string, string) {
-	// Check for table variants
-	if format == "table" {
-		return "table", "day", ""
-	}
-	if strings.HasPrefix(format, "table:") {
-		groupBy := strings.TrimPrefix(format, "table:")
-		// Validate groupBy
-		validGroupings := map[string]bool{"day": true, "model": true, "day,model": true, "hour": true, "weekday": true, "month": true, "month,model": true, "cwd": true, "cwd,branch": true, "source": true, "provider": true, "source,model": true}
-		if !validGroupings[groupBy] {
-			log.Fatalf("Invalid table grouping: %s (valid: day, model, day,model, hour, weekday, month, month,model, cwd, cwd,branch, source, provider, source,model)", groupBy)
-		}
-		return "table", groupBy, ""
+// groupDimension is one field that can be combined with others into a group
+// spec such as "model,weekday"
+type groupDimension struct {
+	Label     string                    // Label column header
+	Value     func(CostRecord) string   // Key part for a record
+	Display   func(value string) string // Shortens a key part for display (nil = as-is)
+	SortValue func(value string) string // Transforms a key part for sorting (nil = as-is)
+}
+
+// weekdayOrder sorts full weekday names in calendar order (Mon=1, ..., Sun=7)
+var weekdayOrder = map[string]string{"Monday": "1", "Tuesday": "2", "Wednesday": "3", "Thursday": "4", "Friday": "5", "Saturday": "6", "Sunday": "7"}
+
+// groupDimensions are the dimensions accepted in arbitrary group specs
+var groupDimensions = map[string]groupDimension{
+	"day": {
+		Label: "Date",
+		Value: func(record CostRecord) string { return record.Timestamp },
+	},
+	"model": {
+		Label: "Model",
+		Value: func(record CostRecord) string { return record.PricingKey },
+	},
+	"hour": {
+		Label: "Hour",
+		Value: func(record CostRecord) string { return fmt.Sprintf("%02d:00", record.Hour) },
+	},
+	"weekday": {
+		Label: "Day",
+		Value: func(record CostRecord) string { return record.Weekday },
+		Display: func(value string) string {
+			if !weekdayFull && len(value) > 3 && value != otherGroupLabel {
+				return value[:3]
+			}
+			return value
+		},
+		SortValue: func(value string) string {
+			if o, ok := weekdayOrder[value]; ok {
+				return o
+			}
+			return value
+		},
+	},
+	"cwd": {
+		Label: "Directory",
+		Value: func(record CostRecord) string {
+			if record.Cwd == "" {
+				return "(unknown)"
+			}
+			return record.Cwd
+		},
+	},
+	"branch": {
+		Label: "Branch",
+		Value: func(record CostRecord) string {
+			if record.GitBranch == "" {
+				return "(none)"
+			}
+			return record.GitBranch
+		},
+	},
+	"session": {
+		Label: "Session",
+		Value: func(record CostRecord) string {
+			if record.SessionID == "" {
+				return "(none)"
+			}
+			return record.SessionID
+		},
+		Display: func(value string) string {
+			if len(value) > 8 && value != otherGroupLabel {
+				return value[:8]
+			}
+			return value
+		},
+	},
+}
+
+// comboGroupConfig synthesizes a GroupConfig for a comma-separated list of
+// groupDimensions such as "model,weekday", hierarchical when more than one is
+// given. ok is false if a name is unknown or repeated.
+func comboGroupConfig(spec string) (GroupConfig, bool) {
+	names := strings.Split(spec, ",")
+	dims := make([]groupDimension, len(names))
+	labelColumns := make([]string, len(names))
+	for i, name := range names {
+		dim, ok := groupDimensions[name]
+		if !ok || slices.Contains(names[:i], name) {
+			return GroupConfig{}, false
+		}
+		dims[i] = dim
+		labelColumns[i] = dim.Label
+	}
+
+	// mapParts applies a per-dimension transform to each part of a key
+	mapParts := func(key string, transform func(groupDimension) func(string) string) []string {
+		parts := splitGroupKey(key)
+		for i, part := range parts {
+			if i < len(dims) {
+				if f := transform(dims[i]); f != nil {
+					parts[i] = f(part)
+				}
+			}
+		}
+		return parts
+	}
+	return GroupConfig{
+		LabelColumns: labelColumns,
+		BuildGroupKey: func(record CostRecord) string {
+			parts := make([]string, len(dims))
+			for i, dim := range dims {
+				parts[i] = dim.Value(record)
+			}
+			return joinGroupKey(parts...)
+		},
+		ParseGroupKey: func(key string) []string {
+			return mapParts(key, func(d groupDimension) func(string) string { return d.Display })
+		},
+		SortKey: func(key string) string {
+			return joinGroupKey(mapParts(key, func(d groupDimension) func(string) string { return d.SortValue })...)
+		},
+		Hierarchical: len(dims) > 1,
+	}, true
+}
+
+// fiscalStart anchors the fiscal-week grouping (set by -fiscal-start)
+var fiscalStart time.Time
+
+// fiscalWeekIndex returns the 0-based number of whole 7-day periods between
+// fiscalStart and a "2006-01-02" date. Dates before the anchor are negative.
+func fiscalWeekIndex(date string) int {
+	d, err := time.Parse("2006-01-02", date)
+	if err != nil {
+		return 0
+	}
+	anchor := time.Date(fiscalStart.Year(), fiscalStart.Month(), fiscalStart.Day(), 0, 0, 0, 0, time.UTC)
+	days := int(d.Sub(anchor).Hours() / 24)
+	if days < 0 {
+		return -((-days + 6) / 7) // floor division
+	}
+	return days / 7
+}
+
+// fiscalWeekLabel formats a fiscal week index: 0 is FY-W01, -1 is FY-W-01
+func fiscalWeekLabel(index int) string {
+	if index < 0 {
+		return fmt.Sprintf("FY-W-%02d", -index)
+	}
+	return fmt.Sprintf("FY-W%02d", index+1)
+}
+
+// parseFiscalWeekLabel is the inverse of fiscalWeekLabel
+func parseFiscalWeekLabel(label string) int {
+	rest := strings.TrimPrefix(label, "FY-W")
+	if n, ok := strings.CutPrefix(rest, "-"); ok {
+		v, _ := strconv.Atoi(n)
+		return -v
+	}
+	v, _ := strconv.Atoi(rest)
+	return v - 1
+}
+
+// groupedOutputKinds are output kinds that accept a ":<grouping>" suffix
+var groupedOutputKinds = []string{"table", "prometheus", "gnuplot", "json", "csv", "markdown"}
+
+// parseOutputFormat parses the unified -output flag value
+// Returns: outputKind ("table", "prometheus", "gnuplot", "json" or "summary"), groupBy string, template string
+func parseOutputFormat(format string) (string, string, string) {
+	// Check for grouped variants (table, table:model, prometheus:day, ...)
+	for _, kind := range groupedOutputKinds {
+		if format == kind {
+			return kind, "day", ""
+		}
+		if strings.HasPrefix(format, kind+":") {
+			groupBy := strings.TrimPrefix(format, kind+":")
+			// Validate groupBy
+			validGroupings := map[string]bool{"day": true, "model": true, "day,model": true, "day,model,branch": true, "hour": true, "session-hour": true, "fiscal-week": true, "weekday": true, "week": true, "month": true, "month,model": true, "cwd": true, "cwd,branch": true, "cwd,session": true, "session": true, "branch-prefix": true, "source": true, "provider": true, "source,model": true, "model,tier": true}
+			if _, ok := comboGroupConfig(groupBy); !validGroupings[groupBy] && !ok {
+				log.Fatalf("Invalid %s grouping: %s (valid: day, model, day,model, day,model,branch, hour, session-hour, fiscal-week, weekday, week, month, month,model, cwd, cwd,branch, cwd,session, session, branch-prefix, source, provider, source,model, model,tier, or any comma-separated combination of %s)", kind, groupBy, strings.Join(slices.Sorted(maps.Keys(groupDimensions)), ", "))
+			}
+			return kind, groupBy, ""
+		}
+	}
+
+	// Per-record (ungrouped) exports
+	if format == "csv-records" {
+		return "csv-records", "", ""
+	}
+
+	// Plain summary uses the costsummary template (or JSON with -json)
+	if format == "summary" {
+		return "summary", "", "costsummary"
 	}
 
 	// Check for named templates or custom templates
@@ -720,11 +1621,322 @@ func parseOutputFormat(format string) (string, string, string) {
 	}
 
 	// Unknown format - treat as potential template name
-	log.Fatalf("Unknown output format: %s (valid: table, table:day, table:model, table:day,model, table:hour, table:weekday, table:cwd, table:cwd,branch, totalcost, totaltokens, costsummary, or custom Go template)", format)
+	log.Fatalf("Unknown output format: %s (valid: table, table:day, table:model, table:day,model, table:day,model,branch, table:hour, table:session-hour, table:fiscal-week, table:weekday, table:week, table:month, table:cwd, table:cwd,branch, table:cwd,session, table:session, table:branch-prefix, prometheus[:group], gnuplot[:group], json[:group], csv[:group], markdown[:group], csv-records, totalcost, totaltokens, costsummary, or custom Go template)", format)
 	return "", "", ""
 }
 
-// sortKeys sorts keys according to grouping strategy
+// parseLastWindow returns the start of a rolling window of the given length
+// ending at now. spec is a positive count followed by h, d, w or mo.
+func parseLastWindow(spec string, now time.Time) (time.Time, error) {
+	for _, unit := range []string{"mo", "h", "d", "w"} {
+		count, ok := strings.CutSuffix(spec, unit)
+		if !ok {
+			continue
+		}
+		n, err := strconv.Atoi(count)
+		if err != nil || n <= 0 {
+			return time.Time{}, fmt.Errorf("%q: expected a positive count before %q", spec, unit)
+		}
+		switch unit {
+		case "h":
+			return now.Add(-time.Duration(n) * time.Hour), nil
+		case "d":
+			return now.AddDate(0, 0, -n), nil
+		case "w":
+			return now.AddDate(0, 0, -7*n), nil
+		default:
+			return now.AddDate(0, -n, 0), nil
+		}
+	}
+	return time.Time{}, fmt.Errorf("%q: expected a count with unit h, d, w or mo (e.g. 7d)", spec)
+}
+
+// fillEmptyDays adds zero-metric entries for every date in [start, end] that has
+// no activity, so day tables are contiguous. If start is zero, the earliest
+// date already present is used. Keys are "2006-01-02" dates (the day grouping).
+func fillEmptyDays(metricsByGroup map[string]Metrics, start, end time.Time) {
+	if start.IsZero() {
+		for key := range metricsByGroup {
+			d, err := time.ParseInLocation("2006-01-02", key, end.Location())
+			if err != nil {
+				continue
+			}
+			if start.IsZero() || d.Before(start) {
+				start = d
+			}
+		}
+		if start.IsZero() {
+			return // No data at all
+		}
+	}
+
+	start = time.Date(start.Year(), start.Month(), start.Day(), 0, 0, 0, 0, start.Location())
+	for d := start; !d.After(end); d = d.AddDate(0, 0, 1) {
+		key := d.Format("2006-01-02")
+		if _, ok := metricsByGroup[key]; !ok {
+			metricsByGroup[key] = Metrics{}
+		}
+	}
+}
+
+// mergeSimilarDays collapses runs of consecutive days whose costs are all
+// within tolerance (relative to the run's first day) into one range group,
+// keyed like "2025-11-10–13" or "2025-10-30–11-02". A merged group's metrics
+// are the sum of its days. Keys are "2006-01-02" dates (the day grouping).
+func mergeSimilarDays(metricsByGroup map[string]Metrics, tolerance float64) {
+	keys := slices.Sorted(maps.Keys(metricsByGroup))
+	var run []string
+	var runStart, prevDate time.Time
+	flush := func() {
+		if len(run) > 1 {
+			merged := Metrics{}
+			for _, key := range run {
+				merged.Add(metricsByGroup[key])
+				delete(metricsByGroup, key)
+			}
+			metricsByGroup[dayRangeLabel(runStart, prevDate)] = merged
+		}
+		run = nil
+	}
+	for _, key := range keys {
+		date, err := time.Parse("2006-01-02", key)
+		if err != nil {
+			flush()
+			continue
+		}
+		if len(run) > 0 {
+			base := metricsByGroup[run[0]].Cost
+			similar := math.Abs(metricsByGroup[key].Cost-base) <= tolerance*base
+			if !similar || !date.Equal(prevDate.AddDate(0, 0, 1)) {
+				flush()
+			}
+		}
+		if len(run) == 0 {
+			runStart = date
+		}
+		run = append(run, key)
+		prevDate = date
+	}
+	flush()
+}
+
+// dayRangeLabel formats an inclusive date range, omitting the parts of the
+// end date it shares with the start: "2025-11-10–13", "2025-10-30–11-02"
+func dayRangeLabel(start, end time.Time) string {
+	switch {
+	case start.Year() != end.Year():
+		return start.Format("2006-01-02") + "–" + end.Format("2006-01-02")
+	case start.Month() != end.Month():
+		return start.Format("2006-01-02") + "–" + end.Format("01-02")
+	default:
+		return start.Format("2006-01-02") + "–" + end.Format("02")
+	}
+}
+
+// truncateLabel shortens a label to -truncate-label runes, ending with an ellipsis
+func truncateLabel(label string) string {
+	if truncateLabelWidth <= 0 || utf8.RuneCountInString(label) <= truncateLabelWidth {
+		return label
+	}
+	runes := []rune(label)
+	return string(runes[:max(truncateLabelWidth-1, 0)]) + "…"
+}
+
+// highlightPattern marks label cells to highlight (-highlight); nil = none
+var highlightPattern *regexp.Regexp
+
+// highlightLabel wraps a displayed label in bold/inverse if its full (untruncated)
+// label matches -highlight. No-op without color.
+func highlightLabel(raw, label string) string {
+	if noColor || highlightPattern == nil || !highlightPattern.MatchString(raw) {
+		return label
+	}
+	return "\033[1;7m" + label + "\033[0m"
+}
+
+// displayLabels returns the labels for a group key as shown in the table.
+// Grouping and sorting always use the full key.
+func displayLabels(cfg GroupConfig, key string) []string {
+	labels := cfg.ParseGroupKey(key)
+	for i, label := range labels {
+		labels[i] = truncateLabel(label)
+	}
+	if note, ok := labelAnnotations[key]; ok && len(labels) > 0 {
+		labels[len(labels)-1] += " " + note
+	}
+	if anomalousGroups[key] && len(labels) > 0 {
+		labels[len(labels)-1] += " ⚠"
+	}
+	return labels
+}
+
+// anomalousGroups holds the group keys flagged by -highlight-anomalies
+var anomalousGroups map[string]bool
+
+// findAnomalies returns the groups whose cost is more than sigma standard
+// deviations above the mean group cost. The (other) group is ignored.
+func findAnomalies(metricsByGroup map[string]Metrics, sigma float64) map[string]bool {
+	var costs []float64
+	for _, key := range slices.Sorted(maps.Keys(metricsByGroup)) {
+		if key != otherGroupLabel {
+			costs = append(costs, metricsByGroup[key].Cost)
+		}
+	}
+	if len(costs) < 2 {
+		return nil
+	}
+	mean := 0.0
+	for _, c := range costs {
+		mean += c
+	}
+	mean /= float64(len(costs))
+	variance := 0.0
+	for _, c := range costs {
+		variance += (c - mean) * (c - mean)
+	}
+	stddev := math.Sqrt(variance / float64(len(costs)))
+
+	anomalies := make(map[string]bool)
+	for key, m := range metricsByGroup {
+		if key != otherGroupLabel && m.Cost > mean+sigma*stddev {
+			anomalies[key] = true
+		}
+	}
+	return anomalies
+}
+
+// labelAnnotations holds extra text appended to a group's last label (e.g. -annotate-tier)
+var labelAnnotations map[string]string
+
+// upgradeAnnotations returns "(opus-4.8 saves $X.XX)" annotations for model
+// groups that have a cheaper successor (see modelSuccessors)
+func upgradeAnnotations(metricsByGroup map[string]Metrics) map[string]string {
+	annotations := make(map[string]string)
+	for key, m := range metricsByGroup {
+		if successor, savings, ok := UpgradeSavings(key, m); ok && savings > 0 {
+			annotations[key] = fmt.Sprintf("(%s saves %s)", successor, formatCost(savings))
+		}
+	}
+	return annotations
+}
+
+// longContextAnnotations returns "(N long-ctx)" annotations for model groups,
+// counting the requests billed at the long-context premium. Those requests
+// have their own pricing key (e.g. sonnet-longcontext), so the count goes on
+// the base model's row (sonnet); a premium row with no base row is left as is.
+func longContextAnnotations(metricsByGroup map[string]Metrics) map[string]string {
+	annotations := make(map[string]string)
+	for key, m := range metricsByGroup {
+		base, premium := strings.CutSuffix(key, "-longcontext")
+		if _, ok := metricsByGroup[base]; premium && ok && m.LongContext > 0 {
+			annotations[base] = fmt.Sprintf("(%d long-ctx)", m.LongContext)
+		}
+	}
+	return annotations
+}
+
+// columnFieldName converts a label column header into a field name for
+// machine-readable outputs (e.g. "Branch Prefix" -> "branch_prefix")
+func columnFieldName(column string) string {
+	return strings.ReplaceAll(strings.ToLower(column), " ", "_")
+}
+
+// rowLabels returns the label cells for a table row: displayLabels plus -highlight styling.
+// Use displayLabels for width calculations, since the styling adds escape codes.
+func rowLabels(cfg GroupConfig, key string) []string {
+	labels := displayLabels(cfg, key)
+	for i, raw := range cfg.ParseGroupKey(key) {
+		labels[i] = highlightLabel(raw, labels[i])
+	}
+	if anomalousGroups[key] && !noColor {
+		for i := range labels {
+			labels[i] = "\033[1;33m" + labels[i] + "\033[0m"
+		}
+	}
+	return labels
+}
+
+// otherGroupLabel is the label that groups folded by -min-tokens are merged into
+const otherGroupLabel = "(other)"
+
+// foldSmallGroups merges groups below minTokens total tokens into an
+// otherGroupLabel group. For hierarchical groupings only the last level is
+// folded, so small children collapse into "(other)" under their parent.
+// Totals are unchanged.
+func foldSmallGroups(metricsByGroup map[string]Metrics, cfg GroupConfig, minTokens int) {
+	for key, m := range metricsByGroup {
+		tokens := m.InputTokens + m.OutputTokens + m.CacheReadTokens + m.CacheWriteTokens
+		if tokens >= minTokens {
+			continue
+		}
+
+		otherKey := otherGroupLabel
+		if cfg.Hierarchical {
+			if i := strings.LastIndex(key, groupKeySeparator); i >= 0 {
+				otherKey = key[:i+1] + otherGroupLabel
+			}
+		}
+		if otherKey == key {
+			continue
+		}
+
+		other := metricsByGroup[otherKey]
+		other.Add(m)
+		metricsByGroup[otherKey] = other
+		delete(metricsByGroup, key)
+	}
+}
+
+// foldToTop keeps the n most expensive groups and merges the rest into an
+// otherGroupLabel group. For hierarchical groupings the limit applies to
+// first-level groups; the rest keep their lower levels under "(other)", so
+// e.g. older days still break down by model. Totals are unchanged.
+func foldToTop(metricsByGroup map[string]Metrics, cfg GroupConfig, n int) {
+	firstLevel := func(key string) string {
+		if cfg.Hierarchical {
+			return splitGroupKey(key)[0]
+		}
+		return key
+	}
+
+	costs := make(map[string]float64)
+	for key, m := range metricsByGroup {
+		if label := firstLevel(key); label != otherGroupLabel {
+			costs[label] += m.Cost
+		}
+	}
+	ranked := slices.SortedFunc(maps.Keys(costs), func(a, b string) int {
+		if c := cmp.Compare(costs[b], costs[a]); c != 0 {
+			return c
+		}
+		return strings.Compare(a, b)
+	})
+	kept := make(map[string]bool, n)
+	for _, label := range ranked[:min(n, len(ranked))] {
+		kept[label] = true
+	}
+
+	for key, m := range metricsByGroup {
+		if kept[firstLevel(key)] {
+			continue
+		}
+		otherKey := otherGroupLabel
+		if cfg.Hierarchical {
+			parts := splitGroupKey(key)
+			otherKey = joinGroupKey(append([]string{otherGroupLabel}, parts[1:]...)...)
+		}
+		if otherKey == key {
+			continue
+		}
+		other := metricsByGroup[otherKey]
+		other.Add(m)
+		metricsByGroup[otherKey] = other
+		delete(metricsByGroup, key)
+	}
+}
+
+// sortKeys sorts keys according to grouping strategy.
+// The otherGroupLabel group always sorts last at its level.
 func sortKeys(keys []string, cfg GroupConfig) {
 	// Helper to get sort key for a given key
 	getSortKey := func(key string) string {
@@ -733,50 +1945,134 @@ func sortKeys(keys []string, cfg GroupConfig) {
 		}
 		return key
 	}
+	// Hierarchical keys compare part by part: the labels, or the parts of
+	// the sort key when SortKey remaps them (e.g. weekdays in model,weekday)
+	getSortParts := func(key string) []string {
+		if cfg.SortKey != nil {
+			return splitGroupKey(cfg.SortKey(key))
+		}
+		return cfg.ParseGroupKey(key)
+	}
 
-	for i := 0; i < len(keys); i++ {
-		for j := i + 1; j < len(keys); j++ {
-			if cfg.Hierarchical {
-				// For hierarchical (day,model), sort by all parts
-				partsI := cfg.ParseGroupKey(keys[i])
-				partsJ := cfg.ParseGroupKey(keys[j])
-
-				// Compare each part in order
-				shouldSwap := false
-				for k := 0; k < len(partsI) && k < len(partsJ); k++ {
-					if partsI[k] != partsJ[k] {
-						shouldSwap = partsI[k] > partsJ[k]
-						break
+	if cfg.Hierarchical {
+		// For hierarchical (day,model), sort by all parts, parsing each key once
+		parts := make(map[string][]string, len(keys))
+		for _, key := range keys {
+			parts[key] = getSortParts(key)
+		}
+		sort.SliceStable(keys, func(i, j int) bool {
+			partsI, partsJ := parts[keys[i]], parts[keys[j]]
+			// Compare each part in order
+			for k := 0; k < len(partsI) && k < len(partsJ); k++ {
+				if partsI[k] != partsJ[k] {
+					switch {
+					case partsI[k] == otherGroupLabel:
+						return false
+					case partsJ[k] == otherGroupLabel:
+						return true
 					}
-				}
-				if shouldSwap {
-					keys[i], keys[j] = keys[j], keys[i]
-				}
-			} else {
-				// Use sort key for comparison
-				if getSortKey(keys[i]) > getSortKey(keys[j]) {
-					keys[i], keys[j] = keys[j], keys[i]
+					return partsI[k] < partsJ[k]
 				}
 			}
+			return false
+		})
+		return
+	}
+
+	// Use sort key for comparison, computing each once
+	sortKeyOf := make(map[string]string, len(keys))
+	for _, key := range keys {
+		sortKeyOf[key] = getSortKey(key)
+	}
+	sort.SliceStable(keys, func(i, j int) bool {
+		if keys[i] == otherGroupLabel || keys[j] == otherGroupLabel {
+			return keys[j] == otherGroupLabel && keys[i] != otherGroupLabel
+		}
+		return sortKeyOf[keys[i]] < sortKeyOf[keys[j]]
+	})
+}
+
+// compareGroupMetrics orders two groups for -sort: cost and tokens put the
+// largest first, date the earliest first activity first
+func compareGroupMetrics(a, b Metrics, by string) int {
+	switch by {
+	case "cost":
+		return cmp.Compare(b.Cost, a.Cost)
+	case "tokens":
+		return cmp.Compare(b.InputTokens+b.OutputTokens+b.CacheReadTokens+b.CacheWriteTokens,
+			a.InputTokens+a.OutputTokens+a.CacheReadTokens+a.CacheWriteTokens)
+	case "date":
+		return strings.Compare(a.FirstSeen, b.FirstSeen)
+	}
+	return 0
+}
+
+// sortKeysByMetric reorders label-sorted keys by -sort (by = "label" keeps the
+// label order, so only -reverse applies). Hierarchical keys are ordered level
+// by level: groups by their subtotals, then rows within each group. Ties keep
+// the label order, and (other) stays last at its level.
+func sortKeysByMetric(keys []string, cfg GroupConfig, metricsByGroup map[string]Metrics, by string, reverse bool) {
+	levels := 1
+	if cfg.Hierarchical {
+		levels = len(cfg.LabelColumns)
+	}
+	// prefix returns the key of the group containing key at depth
+	prefix := func(key string, depth int) string {
+		if depth == levels-1 {
+			return key
+		}
+		return joinGroupKey(splitGroupKey(key)[:depth+1]...)
+	}
+	// Subtotals for every group above the detail rows
+	subtotals := make(map[string]Metrics)
+	for _, key := range keys {
+		for depth := 0; depth < levels-1; depth++ {
+			p := prefix(key, depth)
+			subtotal := subtotals[p]
+			subtotal.Add(metricsByGroup[key])
+			subtotals[p] = subtotal
 		}
 	}
+	// The label order is each key's position before sorting
+	position := make(map[string]int, len(keys))
+	for i, key := range keys {
+		position[key] = i
+	}
+
+	sort.SliceStable(keys, func(i, j int) bool {
+		for depth := 0; depth < levels; depth++ {
+			pi, pj := prefix(keys[i], depth), prefix(keys[j], depth)
+			if pi == pj {
+				continue
+			}
+			iOther := pi == otherGroupLabel || strings.HasSuffix(pi, groupKeySeparator+otherGroupLabel)
+			jOther := pj == otherGroupLabel || strings.HasSuffix(pj, groupKeySeparator+otherGroupLabel)
+			if iOther != jOther {
+				return jOther
+			}
+			mi, mj := metricsByGroup[pi], metricsByGroup[pj]
+			if depth < levels-1 {
+				mi, mj = subtotals[pi], subtotals[pj]
+			}
+			c := compareGroupMetrics(mi, mj, by)
+			if c == 0 {
+				c = cmp.Compare(position[keys[i]], position[keys[j]])
+			}
+			if reverse {
+				c = -c
+			}
+			return c < 0
+		}
+		return false
+	})
 }
 
 // renderTable renders the table with metrics
-func renderTable(cfg GroupConfig, keys []string, metricsByGroup map[string]Metrics) {
+func renderTable(w io.Writer, cfg GroupConfig, keys []string, metricsByGroup map[string]Metrics) {
 	// Accumulate totals first (needed for width calculations)
 	totalMetrics := Metrics{}
 	for _, key := range keys {
-		m := metricsByGroup[key]
-		totalMetrics.Cost += m.Cost
-		totalMetrics.InputTokens += m.InputTokens
-		totalMetrics.OutputTokens += m.OutputTokens
-		totalMetrics.CacheReadTokens += m.CacheReadTokens
-		totalMetrics.CacheWriteTokens += m.CacheWriteTokens
-		totalMetrics.InputCost += m.InputCost
-		totalMetrics.OutputCost += m.OutputCost
-		totalMetrics.CacheReadCost += m.CacheReadCost
-		totalMetrics.CacheWriteCost += m.CacheWriteCost
+		totalMetrics.Add(metricsByGroup[key])
 	}
 
 	// Calculate column widths for alignment (include total metrics for proper footer alignment)
@@ -784,16 +2080,19 @@ func renderTable(cfg GroupConfig, keys []string, metricsByGroup map[string]Metri
 	for k, v := range metricsByGroup {
 		allMetrics[k] = v
 	}
-	allMetrics["__total__"] = totalMetrics
+	// Hierarchical subtotals can be as wide as the total, so keep it there even without a footer
+	if !noFooter || cfg.Hierarchical {
+		allMetrics["__total__"] = totalMetrics
+	}
 	widths := calculateColumnWidths(allMetrics)
 
 	// Calculate max label width for display mode selection
 	maxLabelWidth := 0
 	for _, key := range keys {
-		labels := cfg.ParseGroupKey(key)
+		labels := displayLabels(cfg, key)
 		for _, label := range labels {
-			if len(label) > maxLabelWidth {
-				maxLabelWidth = len(label)
+			if w := utf8.RuneCountInString(label); w > maxLabelWidth {
+				maxLabelWidth = w
 			}
 		}
 	}
@@ -801,32 +2100,51 @@ func renderTable(cfg GroupConfig, keys []string, metricsByGroup map[string]Metri
 	if len("Total") > maxLabelWidth {
 		maxLabelWidth = len("Total")
 	}
+	if weekendsSeparate && !noFooter {
+		maxLabelWidth = max(maxLabelWidth, len("Weekday Total"))
+	}
+	if familySubtotals && !noFooter {
+		for _, family := range modelFamilyTotals(keys, metricsByGroup) {
+			maxLabelWidth = max(maxLabelWidth, utf8.RuneCountInString(family.Label))
+		}
+	}
 
 	// Choose display mode based on terminal width
-	termWidth := getTerminalWidth()
+	termWidth := getTerminalWidth(w)
 	displayMode := chooseDisplayMode(maxLabelWidth, len(cfg.LabelColumns), widths, termWidth)
+	if displayMode == DisplayVertical {
+		renderVertical(w, cfg, keys, metricsByGroup, totalMetrics)
+		return
+	}
 
 	// Create table
-	table := tablewriter.NewTable(os.Stdout,
+	table := tablewriter.NewTable(w,
 		tablewriter.WithRenderer(renderer.NewBlueprint(tw.Rendition{
 			Settings: tw.Settings{Separators: tw.Separators{BetweenRows: tw.On}},
 		})))
 
 	// Build headers based on display mode
-	var headers []string
+	headers := slices.Clone(cfg.LabelColumns)
 	switch displayMode {
-	case DisplayWide:
-		headers = append(cfg.LabelColumns, "Input", "Output", "Cache Read", "Cache Write", "Total")
-	case DisplayMedium:
-		headers = append(cfg.LabelColumns, "Input", "Output", "Cache Read", "Cache Write", "Total")
+	case DisplayWide, DisplayMedium:
+		if showRequests && displayMode == DisplayWide {
+			headers = append(headers, "Requests")
+		}
+		for _, col := range displayedMetricColumns(displayMode) {
+			if !hiddenColumns[col.Name] {
+				headers = append(headers, col.Header)
+			}
+		}
+		headers = append(headers, "Total")
 	case DisplayNarrow:
-		headers = append(cfg.LabelColumns, "Total")
+		headers = append(headers, "Total")
 	}
+	headers = append(headers, extraHeaders()...)
 
 	// Configure alignment and formatting BEFORE setting headers
 	alignments := make([]tw.Align, len(headers))
 	for i := range alignments {
-		if i < len(cfg.LabelColumns) {
+		if i < len(cfg.LabelColumns) || headers[i] == "Cost Bar" {
 			alignments[i] = tw.AlignLeft
 		} else {
 			alignments[i] = tw.AlignRight
@@ -851,28 +2169,18 @@ func renderTable(cfg GroupConfig, keys []string, metricsByGroup map[string]Metri
 	// 2. Total column - row totals across all rows (orange)
 	var totalColumnMetrics []Metrics
 	if cfg.Hierarchical {
-		// For hierarchical, include subtotals
-		groupsByFirst := make(map[string][]string)
-		for _, key := range keys {
-			labels := cfg.ParseGroupKey(key)
-			firstLabel := labels[0]
-			groupsByFirst[firstLabel] = append(groupsByFirst[firstLabel], key)
-		}
-		for _, groupKeys := range groupsByFirst {
-			subtotal := Metrics{}
-			for _, key := range groupKeys {
-				m := metricsByGroup[key]
-				subtotal.Cost += m.Cost
-				subtotal.InputTokens += m.InputTokens
-				subtotal.OutputTokens += m.OutputTokens
-				subtotal.CacheReadTokens += m.CacheReadTokens
-				subtotal.CacheWriteTokens += m.CacheWriteTokens
-				subtotal.InputCost += m.InputCost
-				subtotal.OutputCost += m.OutputCost
-				subtotal.CacheReadCost += m.CacheReadCost
-				subtotal.CacheWriteCost += m.CacheWriteCost
-			}
-			totalColumnMetrics = append(totalColumnMetrics, subtotal)
+		// For hierarchical, include the subtotals at every level
+		for depth := 1; depth < len(cfg.LabelColumns); depth++ {
+			subtotals := make(map[string]Metrics)
+			for _, key := range keys {
+				prefix := joinGroupKey(cfg.ParseGroupKey(key)[:depth]...)
+				subtotal := subtotals[prefix]
+				subtotal.Add(metricsByGroup[key])
+				subtotals[prefix] = subtotal
+			}
+			for _, subtotal := range subtotals {
+				totalColumnMetrics = append(totalColumnMetrics, subtotal)
+			}
 		}
 	} else {
 		for _, key := range keys {
@@ -897,11 +2205,16 @@ func renderTable(cfg GroupConfig, keys []string, metricsByGroup map[string]Metri
 	}
 
 	// Find min/max across all cost types in the total row for relative coloring
-	allCosts := []float64{
-		totalMetrics.InputCost,
-		totalMetrics.OutputCost,
-		totalMetrics.CacheReadCost,
-		totalMetrics.CacheWriteCost,
+	var allCosts []float64
+	costsByCell := []float64{totalMetrics.InputCost, totalMetrics.OutputCost, totalMetrics.CacheReadCost, totalMetrics.CacheWriteCost,
+		totalMetrics.Cost, totalMetrics.CacheWrite5mCost, totalMetrics.CacheWrite1hCost}
+	for _, col := range displayedMetricColumns(displayMode) {
+		if !hiddenColumns[col.Name] {
+			allCosts = append(allCosts, costsByCell[col.Cell])
+		}
+	}
+	if len(allCosts) == 0 {
+		allCosts = []float64{totalMetrics.Cost}
 	}
 	minCost := allCosts[0]
 	maxCost := allCosts[0]
@@ -922,110 +2235,357 @@ func renderTable(cfg GroupConfig, keys []string, metricsByGroup map[string]Metri
 	totalRowHeatmap.MaxCacheRead = maxCost
 	totalRowHeatmap.MinCacheWrite = minCost
 	totalRowHeatmap.MaxCacheWrite = maxCost
+	totalRowHeatmap.MinCache5m = minCost
+	totalRowHeatmap.MaxCache5m = maxCost
+	totalRowHeatmap.MinCache1h = minCost
+	totalRowHeatmap.MaxCache1h = maxCost
 	// Total column uses the total cost value
 	totalRowHeatmap.MinTotal = minCost
 	totalRowHeatmap.MaxTotal = maxCost
 
 	if cfg.Hierarchical {
-		// Hierarchical rendering (e.g., day,model with date subtotals)
-		renderHierarchical(table, cfg, keys, metricsByGroup, totalMetrics, widths, mainHeatmap, totalColumnHeatmap, totalRowHeatmap, displayMode)
+		// Hierarchical rendering (e.g., day,model with date subtotals)
+		renderHierarchical(table, cfg, keys, metricsByGroup, totalMetrics, widths, mainHeatmap, totalColumnHeatmap, totalRowHeatmap, displayMode)
+	} else {
+		// Flat rendering
+		// Total rows: the grand total, preceded by weekday/weekend or model
+		// family subtotals when requested
+		var subtotalRows [][]string
+		var totalRow []string
+		if !noFooter {
+			var subtotals []labeledMetrics
+			if weekendsSeparate {
+				weekdayTotal, weekendTotal := splitWeekendTotals(keys, metricsByGroup)
+				subtotals = append(subtotals, labeledMetrics{"Weekday Total", weekdayTotal}, labeledMetrics{"Weekend Total", weekendTotal})
+			}
+			if familySubtotals {
+				subtotals = append(subtotals, modelFamilyTotals(keys, metricsByGroup)...)
+			}
+			for _, subtotal := range subtotals {
+				subtotalColumns := buildRowColumns(subtotal.Metrics, widths, displayMode, mainHeatmap, totalColumnHeatmap, totalMetrics)
+				if cacheBreakeven {
+					subtotalColumns = append(subtotalColumns, "")
+				}
+				if showBars {
+					subtotalColumns = append(subtotalColumns, "")
+				}
+				if cumulative {
+					subtotalColumns = append(subtotalColumns, "")
+				}
+				if relativeTo != "" {
+					subtotalColumns = append(subtotalColumns, "")
+				}
+				subtotalLabels := make([]string, len(cfg.LabelColumns))
+				subtotalLabels[len(subtotalLabels)-1] = subtotal.Label
+				subtotalRows = append(subtotalRows, append(subtotalLabels, subtotalColumns...))
+			}
+			footerLabels := make([]string, len(cfg.LabelColumns))
+			for i := range footerLabels {
+				if i == len(footerLabels)-1 {
+					footerLabels[i] = "Total"
+				} else {
+					footerLabels[i] = ""
+				}
+			}
+			footerMetrics := buildFooterColumns(totalMetrics, widths, displayMode, totalRowHeatmap)
+			if cacheBreakeven {
+				footerMetrics = append(footerMetrics, "")
+			}
+			if showBars {
+				footerMetrics = append(footerMetrics, "")
+			}
+			if cumulative {
+				footerMetrics = append(footerMetrics, formatCost(totalMetrics.Cost))
+			}
+			if relativeTo != "" {
+				footerMetrics = append(footerMetrics, "")
+			}
+			totalRow = append(footerLabels, footerMetrics...)
+		}
+
+		// -total-position top puts the total right under the header
+		if totalRow != nil && totalPosition == "top" {
+			table.Append(totalRow)
+			for _, row := range subtotalRows {
+				table.Append(row)
+			}
+		}
+
+		maxCost := 0.0
+		for _, key := range keys {
+			maxCost = max(maxCost, metricsByGroup[key].Cost)
+		}
+		var baselineCost float64
+		if relativeTo != "" {
+			baselineKey, err := resolveBaseline(relativeTo, keys, metricsByGroup)
+			if err != nil {
+				log.Fatalf("Invalid -relative-to: %v", err)
+			}
+			baselineCost = metricsByGroup[baselineKey].Cost
+		}
+		runningCost := 0.0
+		for _, key := range keys {
+			labels := rowLabels(cfg, key)
+			metricsColumns := buildRowColumns(metricsByGroup[key], widths, displayMode, mainHeatmap, totalColumnHeatmap, totalMetrics)
+			if cacheBreakeven {
+				metricsColumns = append(metricsColumns, formatCacheBreakeven(key))
+			}
+			if showBars {
+				metricsColumns = append(metricsColumns, formatBar(metricsByGroup[key].Cost, maxCost))
+			}
+			if cumulative {
+				// Running total in sorted (chronological for time groupings) order
+				runningCost += metricsByGroup[key].Cost
+				metricsColumns = append(metricsColumns, formatCost(runningCost))
+			}
+			if relativeTo != "" {
+				metricsColumns = append(metricsColumns, formatRelative(metricsByGroup[key].Cost, baselineCost))
+			}
+			table.Append(append(labels, metricsColumns...))
+		}
+
+		if totalRow != nil && totalPosition == "bottom" {
+			for _, row := range subtotalRows {
+				table.Append(row)
+			}
+			table.Footer(totalRow)
+		}
+	}
+
+	table.Render()
+}
+
+// renderVertical writes one "key: value" block per group instead of a table,
+// for terminals too narrow for even narrow mode. Labels go on their own line
+// (joined with " / " for multi-level groupings), so long labels wrap harmlessly.
+// It shows the same rows as renderTable: hierarchical subtotals, flat
+// subtotals and the optional trailing columns, each as a line of its block.
+func renderVertical(w io.Writer, cfg GroupConfig, keys []string, metricsByGroup map[string]Metrics, totalMetrics Metrics) {
+	type field struct {
+		name   string
+		tokens string
+		cost   string
+	}
+	headers := extraHeaders()
+	first := true
+	writeBlock := func(title string, m Metrics, extras []string) {
+		if !first {
+			fmt.Fprintln(w)
+		}
+		first = false
+
+		costs := []float64{m.InputCost, m.OutputCost, m.CacheReadCost, m.CacheWriteCost}
+		tokens := []int{m.InputTokens, m.OutputTokens, m.CacheReadTokens, m.CacheWriteTokens}
+		var fields []field
+		for _, col := range metricColumns {
+			if !hiddenColumns[col.Name] {
+				fields = append(fields, field{col.Header + ":", formatTokens(tokens[col.Cell]), formatCost(costs[col.Cell])})
+			}
+		}
+		totalTokens := m.InputTokens + m.OutputTokens + m.CacheReadTokens + m.CacheWriteTokens
+		fields = append(fields, field{"Total:", formatTokens(totalTokens), formatCost(m.Cost)})
+
+		// Trailing columns line up with headers; blank cells are left out
+		var extraFields []field
+		for i, value := range extras {
+			if value = strings.TrimRight(value, " "); value != "" && i < len(headers) {
+				extraFields = append(extraFields, field{name: headers[i] + ":", tokens: value})
+			}
+		}
+
+		nameWidth, tokenWidth, costWidth := 0, 0, 0
+		for _, f := range fields {
+			nameWidth = max(nameWidth, len(f.name))
+			tokenWidth = max(tokenWidth, len(f.tokens))
+			costWidth = max(costWidth, len(f.cost))
+		}
+		for _, f := range extraFields {
+			nameWidth = max(nameWidth, len(f.name))
+		}
+		fmt.Fprintln(w, title)
+		for _, f := range fields {
+			fmt.Fprintf(w, "  %-*s %*s %*s\n", nameWidth, f.name, tokenWidth, f.tokens, costWidth, f.cost)
+		}
+		for _, f := range extraFields {
+			fmt.Fprintf(w, "  %-*s %s\n", nameWidth, f.name, f.tokens)
+		}
+	}
+
+	// Flat-table columns after buildExtraColumns', blank where they don't apply
+	flatExtras := func(breakeven, bar, running, relative string) []string {
+		var cols []string
+		if cacheBreakeven {
+			cols = append(cols, breakeven)
+		}
+		if showBars {
+			cols = append(cols, bar)
+		}
+		if cumulative {
+			cols = append(cols, running)
+		}
+		if relativeTo != "" {
+			cols = append(cols, relative)
+		}
+		return cols
+	}
+	writeTotal := func() {
+		if noFooter {
+			return
+		}
+		extras := buildExtraColumns(totalMetrics, totalMetrics)
+		if !cfg.Hierarchical {
+			extras = append(extras, flatExtras("", "", formatCost(totalMetrics.Cost), "")...)
+		}
+		writeBlock("Total", totalMetrics, extras)
+	}
+
+	// Flat tables' weekday/weekend and model family subtotals sit next to the total
+	writeSubtotals := func() {
+		if noFooter || cfg.Hierarchical {
+			return
+		}
+		var subtotals []labeledMetrics
+		if weekendsSeparate {
+			weekdayTotal, weekendTotal := splitWeekendTotals(keys, metricsByGroup)
+			subtotals = append(subtotals, labeledMetrics{"Weekday Total", weekdayTotal}, labeledMetrics{"Weekend Total", weekendTotal})
+		}
+		if familySubtotals {
+			subtotals = append(subtotals, modelFamilyTotals(keys, metricsByGroup)...)
+		}
+		for _, subtotal := range subtotals {
+			writeBlock(subtotal.Label, subtotal.Metrics, buildExtraColumns(subtotal.Metrics, totalMetrics))
+		}
+	}
+
+	if totalPosition == "top" {
+		writeTotal()
+		writeSubtotals()
+	}
+
+	if cfg.Hierarchical {
+		// A subtotal block per group, followed by its children, as in renderHierarchical
+		levels := len(cfg.LabelColumns)
+		var writeLevel func(parents []string, groupKeys []string)
+		writeLevel = func(parents []string, groupKeys []string) {
+			depth := len(parents)
+			if depth == levels-1 {
+				sortHierarchyDetails(groupKeys, metricsByGroup)
+				for _, key := range groupKeys {
+					writeBlock(strings.Join(displayLabels(cfg, key), " / "), metricsByGroup[key], buildExtraColumns(metricsByGroup[key], totalMetrics))
+				}
+				return
+			}
+			labels, groups := hierarchyGroups(cfg, groupKeys, depth)
+			for _, label := range labels {
+				subtotal := Metrics{}
+				for _, key := range groups[label] {
+					subtotal.Add(metricsByGroup[key])
+				}
+				path := append(slices.Clone(parents), truncateLabel(label))
+				writeBlock(strings.Join(path, " / ")+" / Total", subtotal, buildExtraColumns(subtotal, totalMetrics))
+				writeLevel(path, groups[label])
+			}
+		}
+		writeLevel(nil, keys)
 	} else {
-		// Flat rendering
+		maxCost := 0.0
 		for _, key := range keys {
-			labels := cfg.ParseGroupKey(key)
-			var metricsColumns []string
-			switch displayMode {
-			case DisplayWide:
-				metricsColumns = buildMetricsColumnsWithMixedHeatmap(metricsByGroup[key], widths, mainHeatmap, totalColumnHeatmap)
-			case DisplayMedium:
-				metricsColumns = buildMetricsColumnsMedium(metricsByGroup[key], widths, mainHeatmap, totalColumnHeatmap)
-			case DisplayNarrow:
-				metricsColumns = buildMetricsColumnsNarrow(metricsByGroup[key], widths, totalColumnHeatmap)
-			}
-			table.Append(append(labels, metricsColumns...))
+			maxCost = max(maxCost, metricsByGroup[key].Cost)
 		}
-
-		// Footer with total
-		footerLabels := make([]string, len(cfg.LabelColumns))
-		for i := range footerLabels {
-			if i == len(footerLabels)-1 {
-				footerLabels[i] = "Total"
-			} else {
-				footerLabels[i] = ""
+		var baselineCost float64
+		if relativeTo != "" {
+			baselineKey, err := resolveBaseline(relativeTo, keys, metricsByGroup)
+			if err != nil {
+				log.Fatalf("Invalid -relative-to: %v", err)
 			}
+			baselineCost = metricsByGroup[baselineKey].Cost
+		}
+		runningCost := 0.0
+		for _, key := range keys {
+			m := metricsByGroup[key]
+			runningCost += m.Cost
+			extras := append(buildExtraColumns(m, totalMetrics), flatExtras(formatCacheBreakeven(key), formatBar(m.Cost, maxCost), formatCost(runningCost), formatRelative(m.Cost, baselineCost))...)
+			writeBlock(strings.Join(displayLabels(cfg, key), " / "), m, extras)
 		}
-		var footerMetrics []string
-		switch displayMode {
-		case DisplayWide:
-			footerMetrics = buildMetricsColumnsColored(totalMetrics, widths, totalRowHeatmap, "purple")
-		case DisplayMedium:
-			footerMetrics = buildMetricsColumnsMedium(totalMetrics, widths, totalRowHeatmap, totalRowHeatmap)
-		case DisplayNarrow:
-			footerMetrics = buildMetricsColumnsNarrow(totalMetrics, widths, totalRowHeatmap)
+		if totalPosition == "bottom" {
+			writeSubtotals()
 		}
-		table.Footer(append(footerLabels, footerMetrics...))
 	}
 
-	table.Render()
+	if totalPosition == "bottom" {
+		writeTotal()
+	}
 }
 
 // SummaryData holds data for template rendering
 type SummaryData struct {
-	TotalCost        float64
-	InputTokens      int
-	OutputTokens     int
-	CacheReadTokens  int
-	CacheWriteTokens int
-	TotalTokens      int
-	InputCost        float64
-	OutputCost       float64
-	CacheReadCost    float64
-	CacheWriteCost   float64
+	TotalCost        float64 `json:"total_cost"`
+	InputTokens      int     `json:"input_tokens"`
+	OutputTokens     int     `json:"output_tokens"`
+	CacheReadTokens  int     `json:"cache_read_tokens"`
+	CacheWriteTokens int     `json:"cache_write_tokens"`
+	TotalTokens      int     `json:"total_tokens"`
+	InputCost        float64 `json:"input_cost"`
+	OutputCost       float64 `json:"output_cost"`
+	CacheReadCost    float64 `json:"cache_read_cost"`
+	CacheWriteCost   float64 `json:"cache_write_cost"`
 	// Time-based breakdowns
-	Today     Metrics
-	ThisWeek  Metrics
-	ThisMonth Metrics
-	// Pre-formatted strings for aligned output
-	TodayCost       string
-	ThisWeekCost    string
-	ThisMonthCost   string
-	TodayTokens     string
-	ThisWeekTokens  string
-	ThisMonthTokens string
+	Today     Metrics `json:"today"`
+	ThisWeek  Metrics `json:"this_week"`
+	ThisMonth Metrics `json:"this_month"`
+	// Breakdown by usage service tier (standard, batch, ...); empty tier is "(standard)"
+	ByTier map[string]Metrics `json:"by_tier"`
+	// Exactly the filtered records, and the range they were filtered to.
+	// Without a range filter, the range spans the earliest to latest record.
+	RangeTotal Metrics   `json:"range_total"`
+	RangeStart time.Time `json:"range_start,omitzero"`
+	RangeEnd   time.Time `json:"range_end,omitzero"`
+	// Per-request cost distribution over the filtered records (0 when there are none)
+	MedianRequestCost float64 `json:"median_request_cost"`
+	P90RequestCost    float64 `json:"p90_request_cost"`
+	// Pre-formatted strings for aligned output (templates only, not JSON)
+	TodayCost       string `json:"-"`
+	ThisWeekCost    string `json:"-"`
+	ThisMonthCost   string `json:"-"`
+	TodayTokens     string `json:"-"`
+	ThisWeekTokens  string `json:"-"`
+	ThisMonthTokens string `json:"-"`
+}
+
+// percentile returns the nearest-rank p-th percentile of sorted values, or 0 if empty
+func percentile(sorted []float64, p float64) float64 {
+	if len(sorted) == 0 {
+		return 0
+	}
+	rank := int(math.Ceil(p / 100 * float64(len(sorted))))
+	return sorted[max(rank, 1)-1]
 }
 
 // Named templates for common summary formats
 var namedTemplates = map[string]string{
-	"totalcost":   "${{printf \"%.2f\" .TotalCost}}",
+	"totalcost":   "{{currency}}{{printf \"%.2f\" (convert .TotalCost)}}",
 	"totaltokens": "{{formatTokens .TotalTokens}}",
-	"costsummary": `Today:      ${{.TodayCost}} ({{.TodayTokens}} tokens)
-This Week:  ${{.ThisWeekCost}} ({{.ThisWeekTokens}} tokens)
-This Month: ${{.ThisMonthCost}} ({{.ThisMonthTokens}} tokens)`,
+	"costsummary": `Today:      {{currency}}{{.TodayCost}} ({{.TodayTokens}} tokens)
+This Week:  {{currency}}{{.ThisWeekCost}} ({{.ThisWeekTokens}} tokens)
+This Month: {{currency}}{{.ThisMonthCost}} ({{.ThisMonthTokens}} tokens)`,
 }
 
-// renderSummary outputs a summary using the provided template format
-func renderSummary(metricsByGroup map[string]Metrics, formatStr string, allRecords []CostRecord) error {
+// renderSummary outputs a summary using the provided template format.
+// rangeStart/rangeEnd describe the active record filter (zero = unbounded).
+func renderSummary(w io.Writer, metricsByGroup map[string]Metrics, formatStr string, allRecords []CostRecord, rangeStart, rangeEnd time.Time) error {
 	// Check if formatStr is a named template
 	if namedTemplate, ok := namedTemplates[formatStr]; ok {
 		formatStr = namedTemplate
 	}
 
-	// Calculate totals
+	// Calculate totals (in sorted key order so float sums are reproducible)
 	totalMetrics := Metrics{}
-	for _, m := range metricsByGroup {
-		totalMetrics.Cost += m.Cost
-		totalMetrics.InputTokens += m.InputTokens
-		totalMetrics.OutputTokens += m.OutputTokens
-		totalMetrics.CacheReadTokens += m.CacheReadTokens
-		totalMetrics.CacheWriteTokens += m.CacheWriteTokens
-		totalMetrics.InputCost += m.InputCost
-		totalMetrics.OutputCost += m.OutputCost
-		totalMetrics.CacheReadCost += m.CacheReadCost
-		totalMetrics.CacheWriteCost += m.CacheWriteCost
+	for _, key := range slices.Sorted(maps.Keys(metricsByGroup)) {
+		totalMetrics.Add(metricsByGroup[key])
 	}
 
 	// Calculate time-based breakdowns using normalized dates (midnight)
-	now := time.Now()
+	now := time.Now().In(displayLocation)
 	today := time.Date(now.Year(), now.Month(), now.Day(), 0, 0, 0, 0, now.Location())
 	weekStart := today.AddDate(0, 0, -int(today.Weekday()))
 	monthStart := today.AddDate(0, 0, 1-today.Day())
@@ -1033,57 +2593,58 @@ func renderSummary(metricsByGroup map[string]Metrics, formatStr string, allRecor
 	todayMetrics := Metrics{}
 	weekMetrics := Metrics{}
 	monthMetrics := Metrics{}
+	rangeMetrics := Metrics{}
+	byTier := make(map[string]Metrics)
+	requestCosts := make([]float64, 0, len(allRecords))
 
 	for _, record := range allRecords {
+		rangeMetrics.AddRecord(record)
+		requestCosts = append(requestCosts, record.Cost)
+		if !record.FullTimestamp.IsZero() {
+			if rangeStart.IsZero() || record.FullTimestamp.Before(rangeStart) {
+				rangeStart = record.FullTimestamp
+			}
+			if rangeEnd.IsZero() || record.FullTimestamp.After(rangeEnd) {
+				rangeEnd = record.FullTimestamp
+			}
+		}
+
+		tier := record.ServiceTier
+		if tier == "" {
+			tier = "(standard)"
+		}
+		tierMetrics := byTier[tier]
+		tierMetrics.AddRecord(record)
+		byTier[tier] = tierMetrics
+
 		recordDate, err := time.ParseInLocation("2006-01-02", record.Timestamp, now.Location())
 		if err != nil {
 			continue
 		}
 
 		if !recordDate.Before(today) {
-			todayMetrics.Cost += record.Cost
-			todayMetrics.InputTokens += record.InputTokens
-			todayMetrics.OutputTokens += record.OutputTokens
-			todayMetrics.CacheReadTokens += record.CacheReadTokens
-			todayMetrics.CacheWriteTokens += record.CacheWriteTokens
-			todayMetrics.InputCost += record.InputCost
-			todayMetrics.OutputCost += record.OutputCost
-			todayMetrics.CacheReadCost += record.CacheReadCost
-			todayMetrics.CacheWriteCost += record.CacheWriteCost
+			todayMetrics.AddRecord(record)
 		}
 
 		if !recordDate.Before(weekStart) {
-			weekMetrics.Cost += record.Cost
-			weekMetrics.InputTokens += record.InputTokens
-			weekMetrics.OutputTokens += record.OutputTokens
-			weekMetrics.CacheReadTokens += record.CacheReadTokens
-			weekMetrics.CacheWriteTokens += record.CacheWriteTokens
-			weekMetrics.InputCost += record.InputCost
-			weekMetrics.OutputCost += record.OutputCost
-			weekMetrics.CacheReadCost += record.CacheReadCost
-			weekMetrics.CacheWriteCost += record.CacheWriteCost
+			weekMetrics.AddRecord(record)
 		}
 
 		if !recordDate.Before(monthStart) {
-			monthMetrics.Cost += record.Cost
-			monthMetrics.InputTokens += record.InputTokens
-			monthMetrics.OutputTokens += record.OutputTokens
-			monthMetrics.CacheReadTokens += record.CacheReadTokens
-			monthMetrics.CacheWriteTokens += record.CacheWriteTokens
-			monthMetrics.InputCost += record.InputCost
-			monthMetrics.OutputCost += record.OutputCost
-			monthMetrics.CacheReadCost += record.CacheReadCost
-			monthMetrics.CacheWriteCost += record.CacheWriteCost
+			monthMetrics.AddRecord(record)
 		}
 	}
 
+	// Records are already deduped, so each one is a single request
+	slices.Sort(requestCosts)
+
 	// Calculate total tokens for each period
 	todayTotalTokens := todayMetrics.InputTokens + todayMetrics.OutputTokens + todayMetrics.CacheReadTokens + todayMetrics.CacheWriteTokens
 	weekTotalTokens := weekMetrics.InputTokens + weekMetrics.OutputTokens + weekMetrics.CacheReadTokens + weekMetrics.CacheWriteTokens
 	monthTotalTokens := monthMetrics.InputTokens + monthMetrics.OutputTokens + monthMetrics.CacheReadTokens + monthMetrics.CacheWriteTokens
 
 	// Calculate max widths for alignment
-	costs := []float64{todayMetrics.Cost, weekMetrics.Cost, monthMetrics.Cost}
+	costs := []float64{todayMetrics.Cost * currencyRate, weekMetrics.Cost * currencyRate, monthMetrics.Cost * currencyRate}
 	maxCostWidth := 0
 	for _, c := range costs {
 		if w := len(fmt.Sprintf("%.2f", c)); w > maxCostWidth {
@@ -1101,32 +2662,53 @@ func renderSummary(metricsByGroup map[string]Metrics, formatStr string, allRecor
 
 	// Create template data
 	data := SummaryData{
-		TotalCost:        totalMetrics.Cost,
-		InputTokens:      totalMetrics.InputTokens,
-		OutputTokens:     totalMetrics.OutputTokens,
-		CacheReadTokens:  totalMetrics.CacheReadTokens,
-		CacheWriteTokens: totalMetrics.CacheWriteTokens,
-		TotalTokens:      totalMetrics.InputTokens + totalMetrics.OutputTokens + totalMetrics.CacheReadTokens + totalMetrics.CacheWriteTokens,
-		InputCost:        totalMetrics.InputCost,
-		OutputCost:       totalMetrics.OutputCost,
-		CacheReadCost:    totalMetrics.CacheReadCost,
-		CacheWriteCost:   totalMetrics.CacheWriteCost,
-		Today:            todayMetrics,
-		ThisWeek:         weekMetrics,
-		ThisMonth:        monthMetrics,
+		TotalCost:         totalMetrics.Cost,
+		InputTokens:       totalMetrics.InputTokens,
+		OutputTokens:      totalMetrics.OutputTokens,
+		CacheReadTokens:   totalMetrics.CacheReadTokens,
+		CacheWriteTokens:  totalMetrics.CacheWriteTokens,
+		TotalTokens:       totalMetrics.InputTokens + totalMetrics.OutputTokens + totalMetrics.CacheReadTokens + totalMetrics.CacheWriteTokens,
+		InputCost:         totalMetrics.InputCost,
+		OutputCost:        totalMetrics.OutputCost,
+		CacheReadCost:     totalMetrics.CacheReadCost,
+		CacheWriteCost:    totalMetrics.CacheWriteCost,
+		Today:             todayMetrics,
+		ThisWeek:          weekMetrics,
+		ThisMonth:         monthMetrics,
+		ByTier:            byTier,
+		RangeTotal:        rangeMetrics,
+		RangeStart:        rangeStart,
+		RangeEnd:          rangeEnd,
+		MedianRequestCost: percentile(requestCosts, 50),
+		P90RequestCost:    percentile(requestCosts, 90),
 		// Pre-formatted aligned strings
-		TodayCost:       fmt.Sprintf("%*s", maxCostWidth, fmt.Sprintf("%.2f", todayMetrics.Cost)),
-		ThisWeekCost:    fmt.Sprintf("%*s", maxCostWidth, fmt.Sprintf("%.2f", weekMetrics.Cost)),
-		ThisMonthCost:   fmt.Sprintf("%*s", maxCostWidth, fmt.Sprintf("%.2f", monthMetrics.Cost)),
+		TodayCost:       fmt.Sprintf("%*s", maxCostWidth, fmt.Sprintf("%.2f", costs[0])),
+		ThisWeekCost:    fmt.Sprintf("%*s", maxCostWidth, fmt.Sprintf("%.2f", costs[1])),
+		ThisMonthCost:   fmt.Sprintf("%*s", maxCostWidth, fmt.Sprintf("%.2f", costs[2])),
 		TodayTokens:     fmt.Sprintf("%*s", maxTokenWidth, formatTokens(todayTotalTokens)),
 		ThisWeekTokens:  fmt.Sprintf("%*s", maxTokenWidth, formatTokens(weekTotalTokens)),
 		ThisMonthTokens: fmt.Sprintf("%*s", maxTokenWidth, formatTokens(monthTotalTokens)),
 	}
 
+	// -json emits the data itself instead of executing the template
+	if summaryJSON {
+		if err := json.MarshalWrite(w, data, json.Deterministic(true)); err != nil {
+			return fmt.Errorf("failed to write summary JSON: %w", err)
+		}
+		fmt.Fprintln(w)
+		return nil
+	}
+
 	// Parse and execute template
 	tmpl, err := template.New("summary").Funcs(template.FuncMap{
 		"formatTokens": formatTokens,
 		"printf":       fmt.Sprintf,
+		"currency": func() string {
+			return currencySymbol
+		},
+		"convert": func(usd float64) float64 {
+			return usd * currencyRate
+		},
 		"add": func(a, b int) int {
 			return a + b
 		},
@@ -1135,99 +2717,397 @@ func renderSummary(metricsByGroup map[string]Metrics, formatStr string, allRecor
 		return fmt.Errorf("failed to parse summary format template: %w", err)
 	}
 
-	if err := tmpl.Execute(os.Stdout, data); err != nil {
+	if err := tmpl.Execute(w, data); err != nil {
 		return fmt.Errorf("failed to execute summary template: %w", err)
 	}
-	fmt.Println() // Add newline after output
+	fmt.Fprintln(w) // Add newline after output
 
 	return nil
 }
 
-// renderHierarchical renders hierarchical groupings with subtotals
+// renderHierarchical renders hierarchical groupings with subtotals. Keys must
+// already be in display order (sortKeys, then any -sort).
 func renderHierarchical(table *tablewriter.Table, cfg GroupConfig, keys []string, metricsByGroup map[string]Metrics, totalMetrics Metrics, widths ColumnWidths, mainHeatmap HeatmapData, totalColumnHeatmap HeatmapData, totalRowHeatmap HeatmapData, displayMode DisplayMode) {
-	// Group by first label (e.g., date in day,model)
-	groupsByFirst := make(map[string][]string)
-	for _, key := range keys {
-		labels := cfg.ParseGroupKey(key)
-		firstLabel := labels[0]
-		groupsByFirst[firstLabel] = append(groupsByFirst[firstLabel], key)
+	levels := len(cfg.LabelColumns)
+
+	// Grand total, as the first row with -total-position top or the footer otherwise
+	totalLabels := make([]string, levels)
+	totalLabels[levels-1] = "Total"
+	totalRow := append(totalLabels, buildFooterColumns(totalMetrics, widths, displayMode, totalRowHeatmap)...)
+	if !noFooter && totalPosition == "top" {
+		table.Append(totalRow)
+	}
+
+	// Render each group at the level below parents (the displayed labels of
+	// the enclosing groups): a subtotal row per group followed by its children,
+	// down to the detail rows at the last level
+	var renderLevel func(parents []string, groupKeys []string)
+	renderLevel = func(parents []string, groupKeys []string) {
+		depth := len(parents)
+		if depth == levels-1 {
+			// Render detail rows
+			sortHierarchyDetails(groupKeys, metricsByGroup)
+			for _, key := range groupKeys {
+				labels := rowLabels(cfg, key)
+				metricsColumns := buildRowColumns(metricsByGroup[key], widths, displayMode, mainHeatmap, totalColumnHeatmap, totalMetrics)
+				table.Append(append(labels, metricsColumns...))
+			}
+			return
+		}
+
+		labels, groups := hierarchyGroups(cfg, groupKeys, depth)
+		for _, label := range labels {
+			// Calculate subtotal
+			subtotal := Metrics{}
+			for _, key := range groups[label] {
+				subtotal.Add(metricsByGroup[key])
+			}
+
+			// Render subtotal row: the parents, this group's label, then "Total"
+			subtotalLabels := make([]string, levels)
+			copy(subtotalLabels, parents)
+			subtotalLabels[depth] = highlightLabel(label, truncateLabel(label))
+			subtotalLabels[depth+1] = "Total"
+			subtotalColumns := buildRowColumns(subtotal, widths, displayMode, mainHeatmap, totalColumnHeatmap, totalMetrics)
+			table.Append(append(subtotalLabels, subtotalColumns...))
+
+			renderLevel(subtotalLabels[:depth+1], groups[label])
+		}
+	}
+	renderLevel(nil, keys)
+
+	// Footer with grand total
+	if noFooter || totalPosition == "top" {
+		return
+	}
+	table.Footer(totalRow)
+}
+
+// sortHierarchyDetails orders the detail rows of one hierarchical group for
+// -sort-within-hierarchy cost: most expensive first, (other) last. Key order
+// is kept otherwise.
+func sortHierarchyDetails(groupKeys []string, metricsByGroup map[string]Metrics) {
+	if sortWithinHierarchy != "cost" {
+		return
 	}
+	sort.SliceStable(groupKeys, func(i, j int) bool {
+		iOther := strings.HasSuffix(groupKeys[i], groupKeySeparator+otherGroupLabel)
+		jOther := strings.HasSuffix(groupKeys[j], groupKeySeparator+otherGroupLabel)
+		if iOther != jOther {
+			return jOther
+		}
+		return metricsByGroup[groupKeys[i]].Cost > metricsByGroup[groupKeys[j]].Cost
+	})
+}
 
-	// Get sorted first-level keys
-	var firstLevelKeys []string
-	for k := range groupsByFirst {
-		firstLevelKeys = append(firstLevelKeys, k)
+// hierarchyGroups splits sorted keys by their label at depth, returning the
+// distinct labels in key order and the keys under each
+func hierarchyGroups(cfg GroupConfig, keys []string, depth int) ([]string, map[string][]string) {
+	var labels []string
+	groups := make(map[string][]string)
+	for _, key := range keys {
+		label := cfg.ParseGroupKey(key)[depth]
+		if _, ok := groups[label]; !ok {
+			labels = append(labels, label)
+		}
+		groups[label] = append(groups[label], key)
 	}
-	// Sort first level keys
-	for i := 0; i < len(firstLevelKeys); i++ {
-		for j := i + 1; j < len(firstLevelKeys); j++ {
-			if firstLevelKeys[i] > firstLevelKeys[j] {
-				firstLevelKeys[i], firstLevelKeys[j] = firstLevelKeys[j], firstLevelKeys[i]
+	return labels, groups
+}
+
+// resolveBaseline returns the group key -relative-to compares against:
+// "first" is the first group in display order, "max" the most expensive
+// group, and anything else must name a group (e.g. a date in table:day).
+func resolveBaseline(spec string, keys []string, metricsByGroup map[string]Metrics) (string, error) {
+	switch spec {
+	case "first":
+		if len(keys) == 0 {
+			return "", fmt.Errorf("no groups to take the first of")
+		}
+		return keys[0], nil
+	case "max":
+		if len(keys) == 0 {
+			return "", fmt.Errorf("no groups to take the max of")
+		}
+		best := keys[0]
+		for _, key := range keys[1:] {
+			if metricsByGroup[key].Cost > metricsByGroup[best].Cost {
+				best = key
 			}
 		}
+		return best, nil
+	}
+	if _, ok := metricsByGroup[spec]; !ok {
+		return "", fmt.Errorf("no group %q in range (use first, max, or a group key such as a date)", spec)
+	}
+	return spec, nil
+}
+
+// formatRelative formats cost as a signed percentage change from the baseline
+// cost (e.g. "+15%", "-8%"). A zero baseline has no meaningful ratio.
+func formatRelative(cost, baseline float64) string {
+	if baseline == 0 {
+		return "n/a"
 	}
+	return fmt.Sprintf("%+.0f%%", (cost-baseline)/baseline*100)
+}
 
-	// Render each first-level group
-	for _, firstKey := range firstLevelKeys {
-		groupKeys := groupsByFirst[firstKey]
+// labeledMetrics is a subtotal row shown above a flat table's grand total
+type labeledMetrics struct {
+	Label   string
+	Metrics Metrics
+}
 
-		// Calculate subtotal
-		subtotal := Metrics{}
-		for _, key := range groupKeys {
-			m := metricsByGroup[key]
-			subtotal.Cost += m.Cost
-			subtotal.InputTokens += m.InputTokens
-			subtotal.OutputTokens += m.OutputTokens
-			subtotal.CacheReadTokens += m.CacheReadTokens
-			subtotal.CacheWriteTokens += m.CacheWriteTokens
-			subtotal.InputCost += m.InputCost
-			subtotal.OutputCost += m.OutputCost
-			subtotal.CacheReadCost += m.CacheReadCost
-			subtotal.CacheWriteCost += m.CacheWriteCost
-		}
-
-		// Render subtotal row
-		subtotalLabels := []string{firstKey, "Total"}
-		var subtotalColumns []string
-		switch displayMode {
-		case DisplayWide:
-			subtotalColumns = buildMetricsColumnsWithMixedHeatmap(subtotal, widths, mainHeatmap, totalColumnHeatmap)
-		case DisplayMedium:
-			subtotalColumns = buildMetricsColumnsMedium(subtotal, widths, mainHeatmap, totalColumnHeatmap)
-		case DisplayNarrow:
-			subtotalColumns = buildMetricsColumnsNarrow(subtotal, widths, totalColumnHeatmap)
-		}
-		table.Append(append(subtotalLabels, subtotalColumns...))
-
-		// Sort and render detail rows
-		sortKeys(groupKeys, cfg)
-		for _, key := range groupKeys {
-			labels := cfg.ParseGroupKey(key)
-			var metricsColumns []string
-			switch displayMode {
-			case DisplayWide:
-				metricsColumns = buildMetricsColumnsWithMixedHeatmap(metricsByGroup[key], widths, mainHeatmap, totalColumnHeatmap)
-			case DisplayMedium:
-				metricsColumns = buildMetricsColumnsMedium(metricsByGroup[key], widths, mainHeatmap, totalColumnHeatmap)
-			case DisplayNarrow:
-				metricsColumns = buildMetricsColumnsNarrow(metricsByGroup[key], widths, totalColumnHeatmap)
+// modelFamily returns the family of a model pricing key: the part before the
+// first "-" (e.g. "opus" for "opus-4.5" and "opus-4.6-longcontext")
+func modelFamily(pricingKey string) string {
+	family, _, _ := strings.Cut(pricingKey, "-")
+	return family
+}
+
+// modelFamilyTotals sums model-grouped metrics by model family, in order of
+// each family's first key. Labels read like "Opus Total".
+func modelFamilyTotals(keys []string, metricsByGroup map[string]Metrics) []labeledMetrics {
+	var totals []labeledMetrics
+	index := make(map[string]int)
+	for _, key := range keys {
+		family := modelFamily(key)
+		i, ok := index[family]
+		if !ok {
+			i = len(totals)
+			index[family] = i
+			label := family
+			if label != "" && label != otherGroupLabel {
+				label = strings.ToUpper(label[:1]) + label[1:]
 			}
-			table.Append(append(labels, metricsColumns...))
+			totals = append(totals, labeledMetrics{Label: label + " Total"})
 		}
+		totals[i].Metrics.Add(metricsByGroup[key])
 	}
+	return totals
+}
 
-	// Footer with grand total
-	footerLabels := []string{"", "Total"}
-	var footerMetrics []string
-	switch displayMode {
-	case DisplayWide:
-		footerMetrics = buildMetricsColumnsColored(totalMetrics, widths, totalRowHeatmap, "purple")
-	case DisplayMedium:
-		footerMetrics = buildMetricsColumnsMedium(totalMetrics, widths, totalRowHeatmap, totalRowHeatmap)
-	case DisplayNarrow:
-		footerMetrics = buildMetricsColumnsNarrow(totalMetrics, widths, totalRowHeatmap)
+// splitWeekendTotals sums day-grouped metrics into weekday (Mon-Fri) and
+// weekend (Sat/Sun) totals. Keys that aren't dates (e.g. "(other)") count as weekdays.
+func splitWeekendTotals(keys []string, metricsByGroup map[string]Metrics) (weekday, weekend Metrics) {
+	for _, key := range keys {
+		date, err := time.Parse("2006-01-02", key)
+		if err == nil && (date.Weekday() == time.Saturday || date.Weekday() == time.Sunday) {
+			weekend.Add(metricsByGroup[key])
+		} else {
+			weekday.Add(metricsByGroup[key])
+		}
+	}
+	return weekday, weekend
+}
+
+// parseAlertRate parses an -alert-rate spec like "5/hour" or "20/day".
+// Returns the dollar threshold and the rolling window it applies to.
+func parseAlertRate(spec string) (float64, time.Duration, error) {
+	amountStr, unit, found := strings.Cut(spec, "/")
+	if !found {
+		return 0, 0, fmt.Errorf("invalid alert rate %q (expected AMOUNT/hour or AMOUNT/day)", spec)
+	}
+	amount, err := strconv.ParseFloat(strings.TrimPrefix(amountStr, "$"), 64)
+	if err != nil || amount <= 0 {
+		return 0, 0, fmt.Errorf("invalid alert rate amount %q", amountStr)
+	}
+
+	switch unit {
+	case "hour", "h":
+		return amount, time.Hour, nil
+	case "day", "d":
+		return amount, 24 * time.Hour, nil
+	default:
+		return 0, 0, fmt.Errorf("invalid alert rate unit %q (valid: hour, day)", unit)
+	}
+}
+
+// projectionMethods maps -project-method values to their descriptions
+var projectionMethods = map[string]string{
+	"linear":     "month-to-date daily average",
+	"trailing7":  "trailing 7-day average",
+	"trailing30": "trailing 30-day average",
+}
+
+// projectionWindowStart returns the first day projectMonthEnd averages over
+// with method: the month start, or the trailing window's start if earlier
+func projectionWindowStart(now time.Time, method string) time.Time {
+	today := time.Date(now.Year(), now.Month(), now.Day(), 0, 0, 0, 0, now.Location())
+	start := today.AddDate(0, 0, 1-today.Day())
+	if days := projectionTrailingDays(method); days > 0 {
+		if trailingStart := today.AddDate(0, 0, 1-days); trailingStart.Before(start) {
+			start = trailingStart
+		}
+	}
+	return start
+}
+
+// projectionTrailingDays returns the trailing window of a -project-method, or
+// 0 for linear
+func projectionTrailingDays(method string) int {
+	switch method {
+	case "trailing7":
+		return 7
+	case "trailing30":
+		return 30
+	}
+	return 0
+}
+
+// monthProjection is a projected month-end cost with a likely range
+type monthProjection struct {
+	Cost      float64
+	Low, High float64 // One standard deviation of the remaining days' total
+}
+
+// projectMonthEnd projects the cost for the month containing now.
+// linear extrapolates the month-to-date average daily cost; trailingN adds the
+// average daily cost over the last N days (today included) for each remaining day.
+// The range treats each remaining day as a draw from the averaged days: the
+// daily standard deviation scaled by the square root of the remaining days,
+// never dropping below what's already been spent.
+func projectMonthEnd(records []CostRecord, now time.Time, method string) monthProjection {
+	today := time.Date(now.Year(), now.Month(), now.Day(), 0, 0, 0, 0, now.Location())
+	monthStart := today.AddDate(0, 0, 1-today.Day())
+	daysInMonth := monthStart.AddDate(0, 1, -1).Day()
+	daysElapsed := today.Day()
+	remaining := daysInMonth - daysElapsed
+
+	trailingDays := projectionTrailingDays(method)
+	windowStart, windowDays := monthStart, daysElapsed
+	if trailingDays > 0 {
+		windowStart, windowDays = today.AddDate(0, 0, 1-trailingDays), trailingDays
+	}
+
+	monthToDate := 0.0
+	daily := make([]float64, windowDays) // Cost per averaged day, oldest first
+	for _, record := range records {
+		date, err := time.ParseInLocation("2006-01-02", record.Timestamp, now.Location())
+		if err != nil || date.After(today) {
+			continue
+		}
+		if !date.Before(monthStart) {
+			monthToDate += record.Cost
+		}
+		if !date.Before(windowStart) {
+			// Rounded, as days across a DST change aren't 24h long
+			daily[int(math.Round(date.Sub(windowStart).Hours()/24))] += record.Cost
+		}
+	}
+
+	mean, variance := 0.0, 0.0
+	for _, cost := range daily {
+		mean += cost
+	}
+	mean /= float64(windowDays)
+	if windowDays > 1 {
+		for _, cost := range daily {
+			variance += (cost - mean) * (cost - mean)
+		}
+		variance /= float64(windowDays - 1)
+	}
+
+	projected := monthToDate + mean*float64(remaining)
+	band := math.Sqrt(variance * float64(remaining))
+	return monthProjection{Cost: projected, Low: max(monthToDate, projected-band), High: projected + band}
+}
+
+// renderProjection writes the projected month-end cost, its likely range and
+// the method used
+func renderProjection(w io.Writer, records []CostRecord, method string) {
+	p := projectMonthEnd(records, time.Now().In(displayLocation), method)
+	fmt.Fprintf(w, "Projected month-end: %s (likely %s-%s, %s)\n", formatCost(p.Cost), formatCost(p.Low), formatCost(p.High), projectionMethods[method])
+}
+
+// renderAlertBanner writes a warning banner if the cost of records within the
+// trailing window exceeds threshold. Returns true if the alert tripped.
+func renderAlertBanner(w io.Writer, records []CostRecord, threshold float64, window time.Duration) bool {
+	cutoff := time.Now().Add(-window)
+	windowCost := 0.0
+	for _, record := range records {
+		if record.FullTimestamp.After(cutoff) {
+			windowCost += record.Cost
+		}
+	}
+	if windowCost <= threshold {
+		return false
+	}
+
+	windowLabel := "hour"
+	if window >= 24*time.Hour {
+		windowLabel = "day"
+	}
+	banner := fmt.Sprintf("!! Spend rate alert: %s in the last %s (threshold %s) !!", formatCost(windowCost), windowLabel, formatCost(threshold))
+	if !noColor {
+		// Bold white on red so the banner stands out from the heatmap
+		banner = "\033[1;97;41m" + banner + "\033[0m"
+	}
+	fmt.Fprintln(w, banner)
+	return true
+}
+
+// expandPath expands environment variables ($WORK, ${WORK}) and a leading
+// "~" or "~/" in a user-supplied path, so "~/foo" doesn't become a literal
+// "~" directory when the shell didn't expand it (e.g. -flag=~/foo).
+func expandPath(path string) (string, error) {
+	path = os.ExpandEnv(path)
+	if path != "~" && !strings.HasPrefix(path, "~/") {
+		return path, nil
+	}
+	home, err := os.UserHomeDir()
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(home, path[1:]), nil
+}
+
+// pathWithin reports whether path is dir or inside it, comparing whole path
+// elements so /src/app doesn't match /src/application
+func pathWithin(path, dir string) bool {
+	path, dir = filepath.Clean(path), filepath.Clean(dir)
+	if path == dir || dir == string(filepath.Separator) {
+		return true
+	}
+	return strings.HasPrefix(path, dir+string(filepath.Separator))
+}
+
+// stringListFlag is a repeatable flag that also accepts comma-separated values
+type stringListFlag []string
+
+func (f *stringListFlag) String() string {
+	return strings.Join(*f, ",")
+}
+
+func (f *stringListFlag) Set(value string) error {
+	for _, v := range strings.Split(value, ",") {
+		if v = strings.TrimSpace(v); v != "" {
+			*f = append(*f, v)
+		}
+	}
+	return nil
+}
+
+// loadListFile reads a list file such as a model allowlist (-models-file) or
+// excluded dates (-exclude-dates-file): one entry per line, blank lines and
+// lines starting with # are ignored.
+func loadListFile(path string) ([]string, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	var models []string
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		models = append(models, line)
 	}
-	table.Footer(append(footerLabels, footerMetrics...))
+	return models, scanner.Err()
 }
 
 // maxWidthOverride is set by the undocumented -maxwidth flag for testing
@@ -1236,15 +3116,175 @@ var maxWidthOverride int
 // noColor disables ANSI color codes in output
 var noColor bool
 
+// Heatmap schemes (getColorForIntensity) for main data cells, the Total
+// column and the total row. -scheme picks dataScheme; cividis covers all three.
+var (
+	dataScheme        = "blue"
+	totalColumnScheme = "orange"
+	totalRowScheme    = "purple"
+)
+
+// color256 selects xterm-256 colors over 24-bit truecolor (-color256, or
+// COLORTERM not advertising truecolor)
+var color256 bool
+
+// hiddenColumns holds breakdown columns omitted by -hide-columns (Total always stays)
+var hiddenColumns map[string]bool
+
+// truncateLabelWidth truncates table label cells to this many runes (0 = no limit)
+var truncateLabelWidth int
+
+// sortWithinHierarchy orders detail rows within each first-level group: "key" or "cost"
+var sortWithinHierarchy string
+
+// showDates adds First/Last columns with the earliest and latest record date per group
+var showDates bool
+
+// cacheBreakeven adds a Breakeven Reads column to table:model (from pricing, not usage)
+var cacheBreakeven bool
+
+// showBars adds a Cost Bar column scaled to the most expensive group (flat tables)
+var showBars bool
+
+// cumulative adds a running-total Cumulative column to flat tables
+var cumulative bool
+
+// relativeTo adds a vs Baseline column to flat tables comparing each group's
+// cost to a baseline group: "first", "max", or a group key
+var relativeTo string
+
+// futureTolerance is how far past now a record may be timestamped before -drop-future drops it
+const futureTolerance = 5 * time.Minute
+
+// displayLocation is the time zone used to bucket records into dates/hours and
+// for "today" windows: local time, or UTC with -utc. History files always use local time.
+var displayLocation = time.Local
+
+// noFooter omits the grand-total footer row from tables
+var noFooter bool
+
+// familySubtotals adds per-family subtotal rows (all Opus, all Haiku, ...)
+// above the grand-total footer of model tables
+var familySubtotals bool
+
+// totalPosition places the grand-total row of tables: "bottom" (footer) or "top"
+var totalPosition = "bottom"
+
+// weekendsSeparate adds Weekday Total and Weekend Total rows above the
+// grand-total footer of day tables
+var weekendsSeparate bool
+
+// showRequests adds a Requests column (deduplicated request count) in wide mode
+var showRequests bool
+
+// weekdayFull shows full weekday names (Monday) instead of abbreviations (Mon)
+var weekdayFull bool
+
+// tokenDecimals is the number of decimal places in abbreviated token counts (366.5m)
+var tokenDecimals = 1
+
+// showPct appends a "% of Total" column to table output
+var showPct bool
+
+// summaryJSON makes summary outputs emit SummaryData as JSON instead of text
+var summaryJSON bool
+
+// showSavings appends a Saved column: dollars cache reads saved versus the input rate
+var showSavings bool
+
+// splitCache shows Cache 5m and Cache 1h columns instead of Cache Write in wide mode
+var splitCache bool
+
 func main() {
 	output := flag.String("output", "table", "Output format: table, table:day, table:model, table:day,model, totalcost, totaltokens, costsummary, or custom Go template")
 	flag.StringVar(output, "o", "table", "Output format (shorthand)")
 	flag.IntVar(&maxWidthOverride, "maxwidth", 0, "")
-	colorMode := flag.String("color", "auto", "Color output: auto, yes, no")
+	selfTest := flag.Bool("self-test", false, "")
+	flag.IntVar(&truncateLabelWidth, "truncate-label", 0, "Truncate table labels to N characters (0 = no limit)")
+	flag.Float64Var(&colorGamma, "gamma", 1.0, "Gamma applied to heatmap color intensity (<1 brightens mid-range, >1 emphasizes the top)")
+	flag.StringVar(&sortWithinHierarchy, "sort-within-hierarchy", "key", "Order of detail rows within hierarchical groups: key or cost")
+	sortBy := flag.String("sort", "label", "Row order: label, cost, tokens or date")
+	reverseSort := flag.Bool("reverse", false, "Reverse the -sort order")
+	highlight := flag.String("highlight", "", "Highlight table label cells matching this regular expression")
+	flag.BoolVar(&showDates, "show-dates", false, "Add First/Last columns with each group's earliest and latest record date")
+	flag.BoolVar(&cacheBreakeven, "cache-breakeven", false, "In table:model, add a column with cache reads needed to pay off a cache write")
+	flag.BoolVar(&showBars, "bars", false, "Add a bar chart column scaled to the most expensive group (flat tables)")
+	flag.BoolVar(&cumulative, "cumulative", false, "Add a running-total Cumulative column (flat tables)")
+	flag.StringVar(&relativeTo, "relative-to", "", "Add a vs Baseline column relative to first, max, or a group key (flat tables)")
+	annotateTier := flag.Bool("annotate-tier", false, "In table:model, annotate rows with their long-context premium request count")
+	upgradeAdvice := flag.Bool("show-upgrade-advice", false, "In table:model, annotate rows with the savings from a cheaper successor model")
+	highlightAnomalies := flag.Bool("highlight-anomalies", false, "Mark table rows whose cost is unusually high with a warning color and ⚠")
+	anomalySigma := flag.Float64("anomaly-sigma", 2, "Standard deviations above the mean cost for -highlight-anomalies")
+	project := flag.Bool("project", false, "Print a projected month-end cost below the table")
+	projectMethod := flag.String("project-method", "linear", "Projection method for -project: linear, trailing7, trailing30")
+	verifyHistoryFlag := flag.Bool("verify-history", false, "Check history files for corrupt, misfiled and duplicate records and exit")
+	compactHistory := flag.Bool("compact-history", false, "Rewrite history files without duplicate or corrupt lines and exit")
+	pruneHistory := flag.String("prune-history", "", "Delete history files that ended more than this long ago (e.g. 90d, 12w, 6mo) and exit")
+	confirmYes := flag.Bool("yes", false, "Confirm -prune-history deletions on a terminal")
+	importDir := flag.String("import", "", "Import archived JSONL files from this directory into history and exit")
+	dumpConfigFlag := flag.Bool("dump-config", false, "Print effective settings and exit")
+	utc := flag.Bool("utc", false, "Bucket days and hours in UTC instead of local time")
+	flag.BoolVar(&noFooter, "no-footer", false, "Omit the grand-total footer from table output")
+	flag.StringVar(&totalPosition, "total-position", "bottom", "Where to place the table grand total: top or bottom")
+	flag.BoolVar(&familySubtotals, "family-subtotals", false, "With table:model, add per-family subtotal rows above the footer")
+	flag.BoolVar(&weekendsSeparate, "weekends-separate", false, "With table:day, total weekdays and weekends separately above the footer")
+	flag.BoolVar(&showRequests, "show-requests", false, "Add a Requests column to wide table output")
+	flag.BoolVar(&weekdayFull, "weekday-full", false, "Show full weekday names (Monday) in table:weekday")
+	flag.IntVar(&tokenDecimals, "token-decimals", 1, "Decimal places for abbreviated token counts (e.g. 366.5m)")
+	flag.BoolVar(&showPct, "show-pct", false, "Add a % of Total column to table output")
+	flag.BoolVar(&summaryJSON, "json", false, "With a summary output (-o summary, totalcost, ...), print all summary data as JSON")
+	flag.BoolVar(&showSavings, "show-savings", false, "Add a Saved column with dollars saved by cache reads")
+	strict := flag.Bool("strict", false, "Exit with an error if any entries use a model with no known pricing")
+	flag.BoolVar(&splitCache, "split-cache", false, "Split Cache Write into Cache 5m and Cache 1h columns in wide tables")
+	colorMode := flag.String("color", "auto", "Color output: auto, always, never")
+	currency := flag.String("currency", "USD", "Currency to display costs in (e.g. EUR); needs -rate")
+	flag.Float64Var(&currencyRate, "rate", 1, "Exchange rate: units of -currency per USD")
+	flag.BoolVar(&color256, "color256", false, "Use xterm-256 colors instead of 24-bit truecolor")
+	flag.StringVar(&dataScheme, "scheme", "blue", "Heatmap color scheme: blue, redgreen or cividis")
 	days := flag.Int("days", 30, "Number of days to show (0 for all)")
 	flag.IntVar(days, "d", 30, "Number of days to show (shorthand)")
+	since := flag.String("since", "", "Only count records on or after this date (YYYY-MM-DD)")
+	until := flag.String("until", "", "Only count records before this date (YYYY-MM-DD)")
+	last := flag.String("last", "", "Only count records in a rolling window ending now, e.g. 24h, 7d, 4w, 3mo")
 	sourceFilter := flag.String("source", "", "Filter by source: claude, opencode (default: all)")
 	flag.StringVar(sourceFilter, "s", "", "Filter by source (shorthand)")
+	modelsFile := flag.String("models-file", "", "File listing allowed models (one pricing key per line)")
+	var allowModels stringListFlag
+	var excludeDates stringListFlag
+	flag.Var(&excludeDates, "exclude-dates", "Dates (YYYY-MM-DD) to drop, e.g. holidays (repeatable or comma-separated)")
+	excludeDatesFile := flag.String("exclude-dates-file", "", "File listing dates to drop (one YYYY-MM-DD per line)")
+	flag.Var(&allowModels, "allow-model", "Allowed model pricing key (repeatable or comma-separated)")
+	cwdFilter := flag.String("cwd", "", "Only count records whose working directory is this directory or below it")
+	branchFilter := flag.String("branch", "", "Only count records on this git branch ((none) for records without one)")
+	var onlyModels stringListFlag
+	flag.Var(&onlyModels, "model", "Only count records with these pricing keys, e.g. opus,opus-4.5 (repeatable or comma-separated)")
+	var extraHistoryDirs stringListFlag
+	flag.Var(&extraHistoryDirs, "extra-history-dir", "Additional history directory to read (repeatable)")
+	flag.StringVar(&historyDirOverride, "history-dir", "", "Directory for history storage (default $XDG_DATA_HOME/ccc/history)")
+	var projectsDirs stringListFlag
+	flag.Var(&projectsDirs, "projects-dir", "Claude Code projects directory to scan for logs (repeatable, default ~/.claude/projects)")
+	noHistory := flag.Bool("no-history", false, "Skip all history I/O: don't read or save history files")
+	alertRate := flag.String("alert-rate", "", "Show an alert banner when spend exceeds a rate, e.g. 5/hour or 20/day")
+	streamJSON := flag.Bool("stream", false, "With -o json, encode groups one at a time instead of buffering the document")
+	includeUUIDColumn := flag.Bool("include-uuid-column", false, "With -o csv-records, add uuid and request_id columns")
+	pushGateway := flag.String("push-gateway", "", "Push metrics to a Prometheus Pushgateway at this URL")
+	pushJob := flag.String("job", "ccc", "Job name for -push-gateway")
+	exportSQLitePath := flag.String("export-sqlite", "", "Upsert deduplicated records into a SQLite database at this path")
+	fiscalStartFlag := flag.String("fiscal-start", "", "Anchor date (YYYY-MM-DD) for fiscal-week grouping")
+	fiscalDropBefore := flag.Bool("fiscal-drop-before", false, "With fiscal-week grouping, exclude records before -fiscal-start")
+	spanWeeks := flag.Int("span-weeks", 0, "For hour/weekday groupings, only use the last N weeks of data")
+	dropFuture := flag.Bool("drop-future", true, "Drop records timestamped in the future (clock skew), with a warning")
+	minTokens := flag.Int("min-tokens", 0, "Fold groups with fewer total tokens into (other)")
+	top := flag.Int("top", 0, "Keep only the N most expensive groups and fold the rest into (other)")
+	mergeSimilarRows := flag.Float64("merge-similar-rows", 0, "In table:day, merge runs of consecutive days whose costs are within this relative tolerance (e.g. 0.05)")
+	elapsedSince := flag.Bool("elapsed-since", false, "In table:day, add an Elapsed column with days since each date")
+	showWeekday := flag.Bool("show-weekday", false, "In table:day, add a Day column with each date's weekday")
+	fillEmptyDaysFlag := flag.Bool("fill-empty-days", false, "In table:day, include zero rows for days without activity")
+	columnOrder := flag.String("column-order", "", "Comma-separated order of breakdown columns: input, output, cache-read, cache-write")
+	hideColumns := flag.String("hide-columns", "", "Comma-separated table columns to hide: input, output, cache-read, cache-write")
+	partialLineReport := flag.Bool("partial-line-report", false, "Report un-parseable lines per history file")
+	outputFile := flag.String("output-file", "", "Write output to file instead of stdout (truncated on each render)")
+	appendSnapshots := flag.Bool("append-snapshots", false, "With -output-file, append a timestamped block per render instead of truncating")
 	cpuProfile := flag.String("cpuprofile", "", "Write CPU profile to file")
 	memProfile := flag.String("memprofile", "", "Write memory profile to file")
 
@@ -1255,23 +3295,267 @@ func main() {
 		fmt.Fprintf(os.Stderr, "        Output format (default \"table\")\n")
 		fmt.Fprintf(os.Stderr, "  -d, --days int\n")
 		fmt.Fprintf(os.Stderr, "        Number of days to show (default 30, 0 for all)\n")
+		fmt.Fprintf(os.Stderr, "  -since string, -until string\n")
+		fmt.Fprintf(os.Stderr, "        Only count records in [since, until), dates as YYYY-MM-DD in local time.\n")
+		fmt.Fprintf(os.Stderr, "        Replaces the -days window, and history files outside it are not read.\n")
+		fmt.Fprintf(os.Stderr, "        costsummary's Today/This Week/This Month stay relative to today\n")
+		fmt.Fprintf(os.Stderr, "  -last string\n")
+		fmt.Fprintf(os.Stderr, "        Only count records in a rolling window ending now: Nh, Nd, Nw or Nmo\n")
+		fmt.Fprintf(os.Stderr, "        (e.g. 24h, 7d, 4w, 3mo). Replaces -days; can't be used with -since/-until\n")
+		fmt.Fprintf(os.Stderr, "  -color auto|always|never\n")
+		fmt.Fprintf(os.Stderr, "        Color output: auto (default) colors only a terminal and honors\n")
+		fmt.Fprintf(os.Stderr, "        NO_COLOR; always forces color even when piped; never disables it\n")
+		fmt.Fprintf(os.Stderr, "  -scheme blue|redgreen|cividis\n")
+		fmt.Fprintf(os.Stderr, "        Heatmap colors for the data cells: blue (default), or redgreen for a\n")
+		fmt.Fprintf(os.Stderr, "        traffic light from green (cheap) through amber to red (expensive).\n")
+		fmt.Fprintf(os.Stderr, "        cividis is a colorblind-safe blue-to-yellow ramp used for all cells\n")
+		fmt.Fprintf(os.Stderr, "  -color256\n")
+		fmt.Fprintf(os.Stderr, "        Use xterm-256 colors for the heatmap instead of 24-bit truecolor. This\n")
+		fmt.Fprintf(os.Stderr, "        is the default unless COLORTERM is truecolor or 24bit\n")
+		fmt.Fprintf(os.Stderr, "  -currency string, -rate float\n")
+		fmt.Fprintf(os.Stderr, "        Show costs in another currency (e.g. -currency EUR -rate 0.92, the\n")
+		fmt.Fprintf(os.Stderr, "        units per USD) in tables, summaries and -alert-rate amounts. CSV,\n")
+		fmt.Fprintf(os.Stderr, "        JSON, Prometheus and gnuplot output and -json stay in USD\n")
 		fmt.Fprintf(os.Stderr, "  -s, --source string\n")
 		fmt.Fprintf(os.Stderr, "        Filter by source: claude, opencode (default: all)\n")
+		fmt.Fprintf(os.Stderr, "  -projects-dir string\n")
+		fmt.Fprintf(os.Stderr, "        Scan this directory for Claude Code .jsonl logs instead of\n")
+		fmt.Fprintf(os.Stderr, "        ~/.claude/projects (repeatable, all roots are merged). History is\n")
+		fmt.Fprintf(os.Stderr, "        still stored in the XDG data directory\n")
+		fmt.Fprintf(os.Stderr, "  -history-dir string\n")
+		fmt.Fprintf(os.Stderr, "        Read and save history in this directory instead of\n")
+		fmt.Fprintf(os.Stderr, "        $XDG_DATA_HOME/ccc/history (~/.local/share/ccc/history)\n")
+		fmt.Fprintf(os.Stderr, "  -extra-history-dir string\n")
+		fmt.Fprintf(os.Stderr, "        Also read history from this directory, e.g. one synced from another\n")
+		fmt.Fprintf(os.Stderr, "        machine (repeatable). New records are only saved to the primary dir\n")
+		fmt.Fprintf(os.Stderr, "  -no-history\n")
+		fmt.Fprintf(os.Stderr, "        Skip all history I/O for the fastest startup: history files are neither\n")
+		fmt.Fprintf(os.Stderr, "        listed, read nor saved, so only live session logs are counted. Useful\n")
+		fmt.Fprintf(os.Stderr, "        for shell prompts, e.g. -no-history -o totalcost\n")
+		fmt.Fprintf(os.Stderr, "  -models-file string, -allow-model string\n")
+		fmt.Fprintf(os.Stderr, "        Only price models in the allowlist (pricing keys such as opus-4.5,\n")
+		fmt.Fprintf(os.Stderr, "        sonnet); everything else is grouped as (excluded). -allow-model is\n")
+		fmt.Fprintf(os.Stderr, "        repeatable and combines with -models-file\n")
+		fmt.Fprintf(os.Stderr, "  -cwd string\n")
+		fmt.Fprintf(os.Stderr, "        Only count records whose working directory is this directory or one of\n")
+		fmt.Fprintf(os.Stderr, "        its subdirectories; records without a directory are dropped\n")
+		fmt.Fprintf(os.Stderr, "  -branch string\n")
+		fmt.Fprintf(os.Stderr, "        Only count records on this git branch (exact match); use (none) for\n")
+		fmt.Fprintf(os.Stderr, "        records without a branch\n")
+		fmt.Fprintf(os.Stderr, "  -model string\n")
+		fmt.Fprintf(os.Stderr, "        Only count records whose pricing key matches exactly (opus, opus-4.5,\n")
+		fmt.Fprintf(os.Stderr, "        sonnet, haiku-3, ...); others are dropped, not grouped. Repeatable or\n")
+		fmt.Fprintf(os.Stderr, "        comma-separated\n")
+		fmt.Fprintf(os.Stderr, "  -exclude-dates string, -exclude-dates-file string\n")
+		fmt.Fprintf(os.Stderr, "        Drop records on these days (YYYY-MM-DD, e.g. holidays) from every\n")
+		fmt.Fprintf(os.Stderr, "        grouping, so daily, weekday and hourly averages aren't diluted. The\n")
+		fmt.Fprintf(os.Stderr, "        excluded cost is reported on stderr. -exclude-dates is repeatable and\n")
+		fmt.Fprintf(os.Stderr, "        combines with -exclude-dates-file (one date per line)\n")
+		fmt.Fprintf(os.Stderr, "  -truncate-label int\n")
+		fmt.Fprintf(os.Stderr, "        Truncate table labels to N characters with an ellipsis (0 = no limit)\n")
+		fmt.Fprintf(os.Stderr, "  -fiscal-start YYYY-MM-DD\n")
+		fmt.Fprintf(os.Stderr, "        Anchor for fiscal-week grouping: weeks are 7-day periods from this\n")
+		fmt.Fprintf(os.Stderr, "        date, labeled FY-W01, FY-W02, ... (earlier weeks are FY-W-01, ...)\n")
+		fmt.Fprintf(os.Stderr, "  -fiscal-drop-before\n")
+		fmt.Fprintf(os.Stderr, "        With fiscal-week grouping, exclude records before -fiscal-start\n")
+		fmt.Fprintf(os.Stderr, "  -span-weeks int\n")
+		fmt.Fprintf(os.Stderr, "        For cyclical groupings (hour, session-hour, weekday), only use the\n")
+		fmt.Fprintf(os.Stderr, "        last N weeks of data to show your current rhythm (0 = all, per -days)\n")
+		fmt.Fprintf(os.Stderr, "  -drop-future\n")
+		fmt.Fprintf(os.Stderr, "        Drop records timestamped more than 5 minutes in the future, e.g. from\n")
+		fmt.Fprintf(os.Stderr, "        container clock skew, and report how many (default true)\n")
+		fmt.Fprintf(os.Stderr, "  -min-tokens int\n")
+		fmt.Fprintf(os.Stderr, "        Fold groups with fewer total tokens into an (other) row; totals are unchanged\n")
+		fmt.Fprintf(os.Stderr, "  -top int\n")
+		fmt.Fprintf(os.Stderr, "        Keep only the N most expensive groups (first-level groups in hierarchical\n")
+		fmt.Fprintf(os.Stderr, "        tables) and fold the rest into an (other) row; totals are unchanged.\n")
+		fmt.Fprintf(os.Stderr, "        Sorts by cost unless -sort is given\n")
+		fmt.Fprintf(os.Stderr, "  -gamma float\n")
+		fmt.Fprintf(os.Stderr, "        Gamma applied to heatmap intensity: <1 brightens mid-range values,\n")
+		fmt.Fprintf(os.Stderr, "        >1 emphasizes only the top end (default 1.0)\n")
+		fmt.Fprintf(os.Stderr, "  -sort label|cost|tokens|date, -reverse\n")
+		fmt.Fprintf(os.Stderr, "        Order rows by group label (default), cost or tokens (largest first),\n")
+		fmt.Fprintf(os.Stderr, "        or date of first activity (oldest first). Hierarchical tables order\n")
+		fmt.Fprintf(os.Stderr, "        groups by their subtotals and rows within each group. -reverse flips\n")
+		fmt.Fprintf(os.Stderr, "        the order; (other) stays last\n")
+		fmt.Fprintf(os.Stderr, "  -sort-within-hierarchy key|cost\n")
+		fmt.Fprintf(os.Stderr, "        Order detail rows within each group of a hierarchical table by key\n")
+		fmt.Fprintf(os.Stderr, "        (default) or by cost, most expensive first\n")
+		fmt.Fprintf(os.Stderr, "  -highlight regex\n")
+		fmt.Fprintf(os.Stderr, "        Show table label cells matching regex in bold/inverse (color only)\n")
+		fmt.Fprintf(os.Stderr, "  -show-dates\n")
+		fmt.Fprintf(os.Stderr, "        Add First/Last columns with each group's earliest and latest record\n")
+		fmt.Fprintf(os.Stderr, "        date, e.g. when each model was first and last used in table:model\n")
+		fmt.Fprintf(os.Stderr, "  -cache-breakeven\n")
+		fmt.Fprintf(os.Stderr, "        In table:model, add a Breakeven Reads column: how many reads of a cached\n")
+		fmt.Fprintf(os.Stderr, "        prefix pay back the 5m cache write premium, from each model's pricing\n")
+		fmt.Fprintf(os.Stderr, "  -bars\n")
+		fmt.Fprintf(os.Stderr, "        Add a Cost Bar column: a horizontal bar per row scaled to the most\n")
+		fmt.Fprintf(os.Stderr, "        expensive group ('#' bars without color). Not for hierarchical tables\n")
+		fmt.Fprintf(os.Stderr, "  -cumulative\n")
+		fmt.Fprintf(os.Stderr, "        Add a Cumulative column with the running cost total in row order\n")
+		fmt.Fprintf(os.Stderr, "        (e.g. spend-to-date in table:day). Not for hierarchical tables\n")
+		fmt.Fprintf(os.Stderr, "  -relative-to string\n")
+		fmt.Fprintf(os.Stderr, "        Add a vs Baseline column with each group's cost change from a baseline\n")
+		fmt.Fprintf(os.Stderr, "        group: first, max, or a group key (e.g. 2025-06-01 in table:day).\n")
+		fmt.Fprintf(os.Stderr, "        Not for hierarchical tables\n")
+		fmt.Fprintf(os.Stderr, "  -annotate-tier\n")
+		fmt.Fprintf(os.Stderr, "        In table:model, append the number of requests billed at the >200K\n")
+		fmt.Fprintf(os.Stderr, "        long-context premium to the base model's row, e.g. \"sonnet (3 long-ctx)\"\n")
+		fmt.Fprintf(os.Stderr, "  -show-upgrade-advice\n")
+		fmt.Fprintf(os.Stderr, "        In table:model, annotate models that have a cheaper successor with what\n")
+		fmt.Fprintf(os.Stderr, "        the same tokens would have saved, e.g. \"opus (opus-4.8 saves $12.34)\"\n")
+		fmt.Fprintf(os.Stderr, "  -highlight-anomalies, -anomaly-sigma float\n")
+		fmt.Fprintf(os.Stderr, "        Mark groups whose cost is more than -anomaly-sigma (default 2) standard\n")
+		fmt.Fprintf(os.Stderr, "        deviations above the mean group cost with ⚠, in a warning color when\n")
+		fmt.Fprintf(os.Stderr, "        color is enabled. Most useful with table:day\n")
+		fmt.Fprintf(os.Stderr, "  -project, -project-method linear|trailing7|trailing30\n")
+		fmt.Fprintf(os.Stderr, "        Print a projected month-end cost below the table. linear extrapolates\n")
+		fmt.Fprintf(os.Stderr, "        the month-to-date daily average; trailing7/trailing30 add the trailing\n")
+		fmt.Fprintf(os.Stderr, "        7/30-day daily average for each remaining day. A likely range (one\n")
+		fmt.Fprintf(os.Stderr, "        standard deviation of daily cost over the averaged days) is shown too.\n")
+		fmt.Fprintf(os.Stderr, "        Warns when -days/-since load less than the averaged window\n")
+		fmt.Fprintf(os.Stderr, "  -import dir\n")
+		fmt.Fprintf(os.Stderr, "        One-shot archival import: read .jsonl files under dir, skip entries\n")
+		fmt.Fprintf(os.Stderr, "        already in history (by UUID), append the rest to the date-bucketed\n")
+		fmt.Fprintf(os.Stderr, "        history files, report counts per date, and exit\n")
+		fmt.Fprintf(os.Stderr, "  -verify-history\n")
+		fmt.Fprintf(os.Stderr, "        Parse every history file and report valid, corrupt (un-parseable) and\n")
+		fmt.Fprintf(os.Stderr, "        misfiled (timestamp outside the file's range) lines per file, plus\n")
+		fmt.Fprintf(os.Stderr, "        UUIDs stored more than once. Exits 1 if any problem is found. An\n")
+		fmt.Fprintf(os.Stderr, "        interrupted save is rolled back first, as on a normal run\n")
+		fmt.Fprintf(os.Stderr, "  -compact-history\n")
+		fmt.Fprintf(os.Stderr, "        Rewrite each history file without lines repeating an earlier UUID or\n")
+		fmt.Fprintf(os.Stderr, "        that don't parse, atomically replacing it (same name), report what\n")
+		fmt.Fprintf(os.Stderr, "        was removed per file, and exit. Don't run it while ccc is saving\n")
+		fmt.Fprintf(os.Stderr, "  -prune-history age, -yes\n")
+		fmt.Fprintf(os.Stderr, "        Delete history files whose day ended more than age ago (Nd, Nw or Nmo,\n")
+		fmt.Fprintf(os.Stderr, "        e.g. 90d) and exit. On a terminal it only lists them unless -yes is\n")
+		fmt.Fprintf(os.Stderr, "        given; non-interactive runs (cron) delete. Files with unrecognized\n")
+		fmt.Fprintf(os.Stderr, "        names are reported and kept\n")
+		fmt.Fprintf(os.Stderr, "  -dump-config\n")
+		fmt.Fprintf(os.Stderr, "        Print the effective settings (resolved values, then every flag) as\n")
+		fmt.Fprintf(os.Stderr, "        key = value lines and exit\n")
+		fmt.Fprintf(os.Stderr, "  -utc\n")
+		fmt.Fprintf(os.Stderr, "        Bucket days, hours and today/week/month windows in UTC instead of\n")
+		fmt.Fprintf(os.Stderr, "        local time, to reconcile with Anthropic's UTC daily breakdown\n")
+		fmt.Fprintf(os.Stderr, "  -no-footer\n")
+		fmt.Fprintf(os.Stderr, "        Omit the grand-total footer row from table output\n")
+		fmt.Fprintf(os.Stderr, "  -total-position string\n")
+		fmt.Fprintf(os.Stderr, "        Place the grand total at the top (under the header) or bottom of tables\n")
+		fmt.Fprintf(os.Stderr, "        (default \"bottom\")\n")
+		fmt.Fprintf(os.Stderr, "  -family-subtotals\n")
+		fmt.Fprintf(os.Stderr, "        With table:model, add subtotal rows per model family (Opus, Sonnet, ...)\n")
+		fmt.Fprintf(os.Stderr, "        above the footer\n")
+		fmt.Fprintf(os.Stderr, "  -weekends-separate\n")
+		fmt.Fprintf(os.Stderr, "        With table:day, add Weekday Total and Weekend Total rows above the footer\n")
+		fmt.Fprintf(os.Stderr, "  -show-requests\n")
+		fmt.Fprintf(os.Stderr, "        Add a Requests column (deduplicated request count) in wide mode\n")
+		fmt.Fprintf(os.Stderr, "  -weekday-full\n")
+		fmt.Fprintf(os.Stderr, "        Show full weekday names (Monday) in table:weekday\n")
+		fmt.Fprintf(os.Stderr, "  -token-decimals int\n")
+		fmt.Fprintf(os.Stderr, "        Decimal places for abbreviated token counts (default 1)\n")
+		fmt.Fprintf(os.Stderr, "  -show-pct\n")
+		fmt.Fprintf(os.Stderr, "        Add a %% of Total column to table output\n")
+		fmt.Fprintf(os.Stderr, "  -json\n")
+		fmt.Fprintf(os.Stderr, "        With a summary output (-o summary, totalcost, ...), print the summary\n")
+		fmt.Fprintf(os.Stderr, "        data (totals, today/week/month, tiers, range) as JSON instead of text\n")
+		fmt.Fprintf(os.Stderr, "  -show-savings\n")
+		fmt.Fprintf(os.Stderr, "        Add a Saved column: dollars saved by cache reads versus paying the input\n")
+		fmt.Fprintf(os.Stderr, "        rate for the same tokens. The footer shows total savings\n")
+		fmt.Fprintf(os.Stderr, "  -alert-rate string\n")
+		fmt.Fprintf(os.Stderr, "        Show a red banner above the table when the trailing hour/day\n")
+		fmt.Fprintf(os.Stderr, "        cost exceeds the given amount (e.g. 5/hour, 20/day)\n")
+		fmt.Fprintf(os.Stderr, "  -stream\n")
+		fmt.Fprintf(os.Stderr, "        With -o json, encode one group at a time instead of buffering the\n")
+		fmt.Fprintf(os.Stderr, "        whole document (for large exports). The output is the same document\n")
+		fmt.Fprintf(os.Stderr, "  -include-uuid-column\n")
+		fmt.Fprintf(os.Stderr, "        With -o csv-records, add uuid and request_id columns to trace a\n")
+		fmt.Fprintf(os.Stderr, "        record back to its session log line\n")
+		fmt.Fprintf(os.Stderr, "  -push-gateway string, -job string\n")
+		fmt.Fprintf(os.Stderr, "        After aggregation, POST metrics (grouped as in -o) in Prometheus\n")
+		fmt.Fprintf(os.Stderr, "        exposition format to <gateway>/metrics/job/<job> (default job \"ccc\")\n")
+		fmt.Fprintf(os.Stderr, "  -export-sqlite path\n")
+		fmt.Fprintf(os.Stderr, "        Upsert deduplicated records (within -days) into a \"records\" table\n")
+		fmt.Fprintf(os.Stderr, "        of a SQLite database, keyed by UUID\n")
+		fmt.Fprintf(os.Stderr, "  -column-order string\n")
+		fmt.Fprintf(os.Stderr, "        Comma-separated display order of the breakdown columns, e.g.\n")
+		fmt.Fprintf(os.Stderr, "        output,input,cache-read,cache-write. Total always stays last\n")
+		fmt.Fprintf(os.Stderr, "  -hide-columns string\n")
+		fmt.Fprintf(os.Stderr, "        Comma-separated table columns to hide: input, output, cache-read,\n")
+		fmt.Fprintf(os.Stderr, "        cache-write. Total still includes their cost\n")
+		fmt.Fprintf(os.Stderr, "  -split-cache\n")
+		fmt.Fprintf(os.Stderr, "        In wide tables, show cache writes as Cache 5m and Cache 1h columns (1h\n")
+		fmt.Fprintf(os.Stderr, "        writes cost twice the input rate, 5m writes 1.25x). Narrower layouts keep\n")
+		fmt.Fprintf(os.Stderr, "        one Cache Write column; -hide-columns cache-write hides both\n")
+		fmt.Fprintf(os.Stderr, "  -fill-empty-days\n")
+		fmt.Fprintf(os.Stderr, "        With the day grouping, add zero-cost rows for inactive days so the\n")
+		fmt.Fprintf(os.Stderr, "        table is contiguous across the -days range\n")
+		fmt.Fprintf(os.Stderr, "  -show-weekday\n")
+		fmt.Fprintf(os.Stderr, "        With the day grouping, add a Day column (Mon, Tue, ...) before the date\n")
+		fmt.Fprintf(os.Stderr, "  -elapsed-since\n")
+		fmt.Fprintf(os.Stderr, "        With the day grouping, add an Elapsed column after the date (today, 3d ago)\n")
+		fmt.Fprintf(os.Stderr, "  -merge-similar-rows float\n")
+		fmt.Fprintf(os.Stderr, "        With the day grouping, merge runs of consecutive days whose costs are\n")
+		fmt.Fprintf(os.Stderr, "        within this relative tolerance of the run's first day (e.g. 0.05 = 5%%)\n")
+		fmt.Fprintf(os.Stderr, "        into one range row like \"2025-11-10–13\" with the summed metrics\n")
+		fmt.Fprintf(os.Stderr, "  -partial-line-report\n")
+		fmt.Fprintf(os.Stderr, "        Print counts of un-parseable (skipped) lines per history file\n")
+		fmt.Fprintf(os.Stderr, "  -strict\n")
+		fmt.Fprintf(os.Stderr, "        Entries from models with no known pricing are counted at $0 with a\n")
+		fmt.Fprintf(os.Stderr, "        warning; -strict makes that an error (non-zero exit) to catch pricing\n")
+		fmt.Fprintf(os.Stderr, "        table drift in CI. The error comes before any output, -push-gateway\n")
+		fmt.Fprintf(os.Stderr, "        push or -export-sqlite export\n")
+		fmt.Fprintf(os.Stderr, "  -output-file string\n")
+		fmt.Fprintf(os.Stderr, "        Write output to file instead of stdout. The file is truncated on\n")
+		fmt.Fprintf(os.Stderr, "        every render unless -append-snapshots is set\n")
+		fmt.Fprintf(os.Stderr, "  -append-snapshots\n")
+		fmt.Fprintf(os.Stderr, "        With -output-file, append a timestamped block per render so the\n")
+		fmt.Fprintf(os.Stderr, "        file accumulates a time series (grows without bound)\n")
+		fmt.Fprintf(os.Stderr, "\nPricing:\n")
+		fmt.Fprintf(os.Stderr, "  Built-in prices can be overridden in $XDG_CONFIG_HOME/ccc/pricing.json\n")
+		fmt.Fprintf(os.Stderr, "  (~/.config/ccc/pricing.json): pricing keys mapped to rates per million\n")
+		fmt.Fprintf(os.Stderr, "  tokens (input, cache_5m_write, cache_1h_write, cache_read, output). Only\n")
+		fmt.Fprintf(os.Stderr, "  changed fields are needed; new keys price models with that name (any case):\n")
+		fmt.Fprintf(os.Stderr, "    {\"opus-4.8\": {\"output\": 20}, \"my-model\": {\"input\": 1, \"output\": 4}}\n")
+		fmt.Fprintf(os.Stderr, "  To record price changes, map a key to a list of rates, oldest first, each\n")
+		fmt.Fprintf(os.Stderr, "  with \"effective_from\": \"YYYY-MM-DD\" (UTC); usage before a date keeps the\n")
+		fmt.Fprintf(os.Stderr, "  rate it replaces:\n")
+		fmt.Fprintf(os.Stderr, "    {\"opus-4.8\": [{\"output\": 20, \"effective_from\": \"2026-05-01\"},\n")
+		fmt.Fprintf(os.Stderr, "                  {\"output\": 15, \"effective_from\": \"2026-08-01\"}]}\n")
 		fmt.Fprintf(os.Stderr, "\nOutput Formats:\n")
 		fmt.Fprintf(os.Stderr, "  table            Table grouped by day (default)\n")
 		fmt.Fprintf(os.Stderr, "  table:day        Same as above\n")
 		fmt.Fprintf(os.Stderr, "  table:model      Table grouped by model\n")
 		fmt.Fprintf(os.Stderr, "  table:day,model  Table with day/model hierarchy\n")
+		fmt.Fprintf(os.Stderr, "  table:day,model,branch Table with day/model/branch hierarchy\n")
 		fmt.Fprintf(os.Stderr, "  table:hour       Table grouped by hour of day\n")
+		fmt.Fprintf(os.Stderr, "  table:session-hour Table grouped by the hour each session started\n")
+		fmt.Fprintf(os.Stderr, "  table:fiscal-week Table grouped by 7-day weeks from -fiscal-start\n")
 		fmt.Fprintf(os.Stderr, "  table:weekday    Table grouped by day of week\n")
-		fmt.Fprintf(os.Stderr, "  table:month      Table grouped by month\n")
+		fmt.Fprintf(os.Stderr, "  table:week       Table grouped by ISO week (2006-W01)\n")
+		fmt.Fprintf(os.Stderr, "  table:month      Table grouped by calendar month of each record\n")
 		fmt.Fprintf(os.Stderr, "  table:month,model Table with month/model hierarchy\n")
+		fmt.Fprintf(os.Stderr, "  table:cwd,session Table with directory/session hierarchy\n")
+		fmt.Fprintf(os.Stderr, "  table:session    Table grouped by session (IDs shortened to 8 characters)\n")
+		fmt.Fprintf(os.Stderr, "  table:branch-prefix Table grouped by branch namespace (feat/, fix/, ...)\n")
 		fmt.Fprintf(os.Stderr, "  table:source     Table grouped by source (claude/opencode)\n")
 		fmt.Fprintf(os.Stderr, "  table:provider   Table grouped by provider\n")
 		fmt.Fprintf(os.Stderr, "  table:source,model Table with source/model hierarchy\n")
+		fmt.Fprintf(os.Stderr, "  table:model,tier Table with model/service tier hierarchy (standard vs batch)\n")
+		fmt.Fprintf(os.Stderr, "  table:a,b,...    Any combination of day, model, hour, weekday, cwd, branch and\n")
+		fmt.Fprintf(os.Stderr, "                   session, e.g. table:model,weekday (nested subtotals)\n")
+		fmt.Fprintf(os.Stderr, "  prometheus       Prometheus text exposition format (accepts :group)\n")
+		fmt.Fprintf(os.Stderr, "  gnuplot          Whitespace-separated data file for gnuplot (accepts :group)\n")
+		fmt.Fprintf(os.Stderr, "  json             JSON document: grand total plus one object per group (accepts :group)\n")
+		fmt.Fprintf(os.Stderr, "                   Read a group's \"labels\"; its \"key\" is for display and can't be split\n")
+		fmt.Fprintf(os.Stderr, "  markdown         GitHub-flavored Markdown table, no color (accepts :group)\n")
+		fmt.Fprintf(os.Stderr, "  csv              CSV with one row per group plus a Total row (accepts :group)\n")
+		fmt.Fprintf(os.Stderr, "  csv-records      CSV with one row per deduplicated record (RFC3339 timestamps)\n")
 		fmt.Fprintf(os.Stderr, "  totalcost        Total cost only (e.g., $239.75)\n")
 		fmt.Fprintf(os.Stderr, "  totaltokens      Total tokens only (e.g., 366.5m)\n")
 		fmt.Fprintf(os.Stderr, "  costsummary      Today/week/month breakdown\n")
+		fmt.Fprintf(os.Stderr, "  summary          Same as costsummary; with -json, all template variables as JSON\n")
 		fmt.Fprintf(os.Stderr, "  {{...}}          Custom Go template\n")
 		fmt.Fprintf(os.Stderr, "\nTemplate Variables:\n")
 		fmt.Fprintf(os.Stderr, "  .TotalCost, .TotalTokens           Total cost/tokens\n")
@@ -1281,8 +3565,14 @@ func main() {
 		fmt.Fprintf(os.Stderr, "  .CacheReadCost, .CacheWriteCost\n")
 		fmt.Fprintf(os.Stderr, "  .Today, .ThisWeek, .ThisMonth      Period breakdowns\n")
 		fmt.Fprintf(os.Stderr, "    (each has .Cost, .InputTokens, .OutputTokens, etc.)\n")
+		fmt.Fprintf(os.Stderr, "  .ByTier                            Metrics by service tier (map)\n")
+		fmt.Fprintf(os.Stderr, "  .RangeTotal                        Metrics for the filtered range (-days, -since/-until)\n")
+		fmt.Fprintf(os.Stderr, "  .RangeStart, .RangeEnd             Bounds of that range (time.Time)\n")
+		fmt.Fprintf(os.Stderr, "  .MedianRequestCost, .P90RequestCost\n")
+		fmt.Fprintf(os.Stderr, "                                     Per-request cost distribution\n")
 		fmt.Fprintf(os.Stderr, "\nTemplate Functions:\n")
 		fmt.Fprintf(os.Stderr, "  formatTokens .TotalTokens          Format as 366.5m\n")
+		fmt.Fprintf(os.Stderr, "  currency, convert .TotalCost       -currency symbol; USD cost in that currency\n")
 		fmt.Fprintf(os.Stderr, "  printf \"%%.2f\" .TotalCost          Format with precision\n")
 		fmt.Fprintf(os.Stderr, "\nExamples:\n")
 		fmt.Fprintf(os.Stderr, "  %s                    # table by day\n", os.Args[0])
@@ -1294,16 +3584,191 @@ func main() {
 		fmt.Fprintf(os.Stderr, "  %s -o '{{.TotalCost}}'# custom template\n", os.Args[0])
 	}
 
-	flag.Parse()
-
+	flag.Parse()
+
+	// Undocumented: verify pricing math against golden fixtures (for CI)
+	if *selfTest {
+		if !runSelfTest(os.Stdout) {
+			os.Exit(1)
+		}
+		return
+	}
+
+	// Merge user pricing overrides (after -self-test, which checks the built-ins)
+	if path, err := PricingConfigPath(); err != nil {
+		log.Printf("Warning: could not locate pricing config: %v", err)
+	} else if _, err := LoadPricingOverrides(path); err != nil {
+		log.Printf("Warning: ignoring pricing config %s, using built-in prices: %v", path, err)
+	}
+
+	if tokenDecimals < 0 {
+		log.Fatalf("Invalid -token-decimals: %d (must be >= 0)", tokenDecimals)
+	}
+
+	if *utc {
+		displayLocation = time.UTC
+	}
+
+	// Expand ~ and $VARS in directory flags
+	for i, dir := range extraHistoryDirs {
+		expanded, err := expandPath(dir)
+		if err != nil {
+			log.Fatalf("Invalid -extra-history-dir %q: %v", dir, err)
+		}
+		extraHistoryDirs[i] = expanded
+	}
+	if expanded, err := expandPath(historyDirOverride); err != nil {
+		log.Fatalf("Invalid -history-dir %q: %v", historyDirOverride, err)
+	} else {
+		historyDirOverride = expanded
+	}
+	explicitProjectsDirs := len(projectsDirs) > 0
+	for i, dir := range projectsDirs {
+		expanded, err := expandPath(dir)
+		if err != nil {
+			log.Fatalf("Invalid -projects-dir %q: %v", dir, err)
+		}
+		projectsDirs[i] = expanded
+	}
+	if !explicitProjectsDirs {
+		home, err := os.UserHomeDir()
+		if err != nil {
+			log.Fatalf("Failed to get home directory: %v", err)
+		}
+		projectsDirs = stringListFlag{filepath.Join(home, ".claude", "projects")}
+	}
+	if expanded, err := expandPath(*importDir); err != nil {
+		log.Fatalf("Invalid -import %q: %v", *importDir, err)
+	} else {
+		*importDir = expanded
+	}
+	if *cwdFilter != "" {
+		expanded, err := expandPath(*cwdFilter)
+		if err == nil {
+			expanded, err = filepath.Abs(expanded)
+		}
+		if err != nil {
+			log.Fatalf("Invalid -cwd %q: %v", *cwdFilter, err)
+		}
+		*cwdFilter = expanded
+	}
+
+	if *importDir != "" {
+		// Roll back an interrupted save before importing: the import reads
+		// history UUIDs for dedup and journals its own batch
+		if err := recoverInterruptedSave(); err != nil {
+			log.Fatalf("Could not recover interrupted history save, not importing: %v", err)
+		}
+		result, err := importHistory(*importDir)
+		if err != nil {
+			log.Fatalf("Import failed: %v", err)
+		}
+		printImportReport(os.Stdout, result)
+		return
+	}
+
+	if *verifyHistoryFlag {
+		// A torn tail from an interrupted save isn't corruption: the next run
+		// rolls it back, so do that first rather than report it
+		if err := recoverInterruptedSave(); err != nil {
+			log.Fatalf("Could not recover interrupted history save: %v", err)
+		}
+		files, err := ListHistoryFiles()
+		if err != nil {
+			log.Fatalf("Could not list history files: %v", err)
+		}
+		result, err := verifyHistory(files)
+		if err != nil {
+			log.Fatalf("Verify failed: %v", err)
+		}
+		printVerifyReport(os.Stdout, result)
+		if !result.OK() {
+			os.Exit(1)
+		}
+		return
+	}
+
+	if *pruneHistory != "" {
+		cutoff, err := parseLastWindow(*pruneHistory, time.Now())
+		if err != nil {
+			log.Fatalf("Invalid -prune-history: %v", err)
+		}
+		files, err := ListHistoryFiles()
+		if err != nil {
+			log.Fatalf("Could not list history files: %v", err)
+		}
+		expired, unparseable := HistoryFilesEndedBefore(slices.Sorted(slices.Values(files)), cutoff.Unix())
+		for _, file := range unparseable {
+			fmt.Printf("keeping %s (not a history file name)\n", filepath.Base(file))
+		}
+		if !*confirmYes && term.IsTerminal(int(os.Stdout.Fd())) {
+			for _, file := range expired {
+				fmt.Printf("would remove %s\n", filepath.Base(file))
+			}
+			fmt.Printf("%d history files ended before %s; rerun with -yes to delete them\n", len(expired), cutoff.Format("2006-01-02"))
+			return
+		}
+		for _, file := range expired {
+			if err := os.Remove(file); err != nil {
+				log.Fatalf("Could not remove %s: %v", file, err)
+			}
+			fmt.Printf("removed %s\n", filepath.Base(file))
+		}
+		fmt.Printf("Removed %d history files ended before %s\n", len(expired), cutoff.Format("2006-01-02"))
+		return
+	}
+
+	if *compactHistory {
+		// Compacting moves lines, so a pending journal's offsets would no
+		// longer match: roll the interrupted save back first
+		if err := recoverInterruptedSave(); err != nil {
+			log.Fatalf("Could not recover interrupted history save, not compacting: %v", err)
+		}
+		files, err := ListHistoryFiles()
+		if err != nil {
+			log.Fatalf("Could not list history files: %v", err)
+		}
+		compacted, totalDuplicates, totalCorrupt := 0, 0, 0
+		for _, file := range slices.Sorted(slices.Values(files)) {
+			if _, _, err := ParseHistoryFilename(file); err != nil {
+				continue // Not ours to rewrite
+			}
+			duplicates, corrupt, err := CompactHistoryFile(file)
+			if err != nil {
+				log.Fatalf("Compacting %s failed: %v", file, err)
+			}
+			compacted++
+			totalDuplicates += duplicates
+			totalCorrupt += corrupt
+			if duplicates > 0 || corrupt > 0 {
+				fmt.Printf("%s: removed %d duplicate, %d corrupt lines\n", filepath.Base(file), duplicates, corrupt)
+			}
+		}
+		fmt.Printf("Compacted %d history files: removed %d duplicate and %d corrupt lines\n", compacted, totalDuplicates, totalCorrupt)
+		return
+	}
+
 	// Set color mode
 	switch *colorMode {
 	case "yes", "true", "always":
 		noColor = false
 	case "no", "false", "never":
 		noColor = true
-	default: // "auto"
-		noColor = !term.IsTerminal(int(os.Stdout.Fd()))
+	case "auto":
+		// https://no-color.org: any non-empty NO_COLOR disables color
+		noColor = *outputFile != "" || !term.IsTerminal(int(os.Stdout.Fd())) || os.Getenv("NO_COLOR") != ""
+	default:
+		log.Fatalf("Invalid -color: %s (valid: auto, always, never)", *colorMode)
+	}
+	switch dataScheme {
+	case "blue", "redgreen":
+	case "cividis":
+		totalColumnScheme, totalRowScheme = dataScheme, dataScheme
+	default:
+		log.Fatalf("Invalid -scheme: %s (valid: blue, redgreen, cividis)", dataScheme)
+	}
+	if colorTerm := os.Getenv("COLORTERM"); colorTerm != "truecolor" && colorTerm != "24bit" {
+		color256 = true
 	}
 
 	// CPU profiling
@@ -1319,10 +3784,169 @@ func main() {
 		defer pprof.StopCPUProfile()
 	}
 
-	// Calculate time range for filtering records
-	var rangeStart int64
+	if *highlight != "" {
+		var err error
+		highlightPattern, err = regexp.Compile(*highlight)
+		if err != nil {
+			log.Fatalf("Invalid -highlight: %v", err)
+		}
+	}
+
+	if sortWithinHierarchy != "key" && sortWithinHierarchy != "cost" {
+		log.Fatalf("Invalid -sort-within-hierarchy: %s (valid: key, cost)", sortWithinHierarchy)
+	}
+	if *top < 0 {
+		log.Fatalf("Invalid -top: %d (must be positive, or 0 for all groups)", *top)
+	}
+	if *top > 0 {
+		// The top groups are listed most expensive first unless -sort says otherwise
+		sortSet := false
+		flag.Visit(func(f *flag.Flag) { sortSet = sortSet || f.Name == "sort" })
+		if !sortSet {
+			*sortBy = "cost"
+		}
+	}
+	if !slices.Contains([]string{"label", "cost", "tokens", "date"}, *sortBy) {
+		log.Fatalf("Invalid -sort: %s (valid: label, cost, tokens, date)", *sortBy)
+	}
+
+	if colorGamma <= 0 || math.IsNaN(colorGamma) || math.IsInf(colorGamma, 0) {
+		log.Fatalf("Invalid -gamma: %v (must be a positive number)", colorGamma)
+	}
+
+	if *columnOrder != "" {
+		if err := reorderMetricColumns(*columnOrder); err != nil {
+			log.Fatalf("Invalid -column-order: %v", err)
+		}
+	}
+
+	// Parse hidden columns
+	if *hideColumns != "" {
+		hiddenColumns = make(map[string]bool)
+		for _, name := range strings.Split(*hideColumns, ",") {
+			name = strings.TrimSpace(name)
+			valid := false
+			for _, col := range metricColumns {
+				if col.Name == name {
+					valid = true
+				}
+			}
+			if !valid {
+				log.Fatalf("Invalid -hide-columns entry: %s (valid: input, output, cache-read, cache-write)", name)
+			}
+			hiddenColumns[name] = true
+		}
+	}
+
+	// Display currency
+	*currency = strings.ToUpper(*currency)
+	if currencyRate <= 0 {
+		log.Fatalf("Invalid -rate: %v (must be positive)", currencyRate)
+	}
+	if *currency != "USD" {
+		rateSet := false
+		flag.Visit(func(f *flag.Flag) { rateSet = rateSet || f.Name == "rate" })
+		if !rateSet {
+			log.Fatalf("-currency %s requires -rate (units of %s per USD)", *currency, *currency)
+		}
+	}
+	if symbol, ok := currencySymbols[*currency]; ok {
+		currencySymbol = symbol
+	} else {
+		currencySymbol = *currency + " "
+	}
+
+	// Parse alert rate
+	var alertThreshold float64
+	var alertWindow time.Duration
+	if *alertRate != "" {
+		var err error
+		alertThreshold, alertWindow, err = parseAlertRate(*alertRate)
+		if err != nil {
+			log.Fatalf("%v", err)
+		}
+		// The amount is in the display currency; spend is tracked in USD
+		alertThreshold /= currencyRate
+	}
+
+	// Build model allowlist
+	if *modelsFile != "" {
+		models, err := loadListFile(*modelsFile)
+		if err != nil {
+			log.Fatalf("Could not read models file: %v", err)
+		}
+		allowModels = append(allowModels, models...)
+	}
+	allowedModels := make(map[string]bool, len(allowModels))
+	for _, m := range allowModels {
+		allowedModels[m] = true
+	}
+
+	// Build -model filter, rejecting names GetModelPricing never produces
+	modelFilter := make(map[string]bool, len(onlyModels))
+	for _, m := range onlyModels {
+		if _, ok := modelPricing[m]; !ok {
+			log.Fatalf("Invalid -model %q (valid: %s)", m, strings.Join(slices.Sorted(maps.Keys(modelPricing)), ", "))
+		}
+		modelFilter[m] = true
+	}
+
+	// Build excluded date set
+	if *excludeDatesFile != "" {
+		dates, err := loadListFile(*excludeDatesFile)
+		if err != nil {
+			log.Fatalf("Could not read exclude dates file: %v", err)
+		}
+		excludeDates = append(excludeDates, dates...)
+	}
+	excludedDates := make(map[string]bool, len(excludeDates))
+	for _, d := range excludeDates {
+		if _, err := time.Parse("2006-01-02", d); err != nil {
+			log.Fatalf("Invalid -exclude-dates date %q (expected YYYY-MM-DD)", d)
+		}
+		excludedDates[d] = true
+	}
+
+	// Calculate time range for filtering records (rangeEnd 0 = unbounded)
+	var rangeStart, rangeEnd int64
+	explicitRange := *since != "" || *until != "" || *last != ""
+	if explicitRange {
+		flag.Visit(func(f *flag.Flag) {
+			if f.Name == "days" || f.Name == "d" {
+				log.Fatalf("-days can't be combined with -since/-until/-last")
+			}
+		})
+		*days = 0
+		if *last != "" {
+			if *since != "" || *until != "" {
+				log.Fatalf("-last can't be combined with -since/-until")
+			}
+			start, err := parseLastWindow(*last, time.Now().In(displayLocation))
+			if err != nil {
+				log.Fatalf("Invalid -last: %v", err)
+			}
+			rangeStart = start.Unix()
+		}
+		if *since != "" {
+			t, err := time.ParseInLocation("2006-01-02", *since, displayLocation)
+			if err != nil {
+				log.Fatalf("Invalid -since date %q (expected YYYY-MM-DD)", *since)
+			}
+			rangeStart = t.Unix()
+		}
+		if *until != "" {
+			t, err := time.ParseInLocation("2006-01-02", *until, displayLocation)
+			if err != nil {
+				log.Fatalf("Invalid -until date %q (expected YYYY-MM-DD)", *until)
+			}
+			rangeEnd = t.Unix()
+		}
+		if rangeEnd != 0 && rangeEnd <= rangeStart {
+			log.Fatalf("-until %s must be after -since %s", *until, *since)
+		}
+	}
 	if *days > 0 {
-		now := time.Now()
+		now := time.Now().In(displayLocation)
 		startTime := now.AddDate(0, 0, -(*days - 1))
 		startTime = time.Date(startTime.Year(), startTime.Month(), startTime.Day(), 0, 0, 0, 0, startTime.Location())
 		rangeStart = startTime.Unix()
@@ -1334,24 +3958,30 @@ func main() {
 		log.Fatalf("Failed to get home directory: %v", err)
 	}
 
-	projectsDir := filepath.Join(homeDir, ".claude", "projects")
-
-	// Collect all JSONL files first
+	// Collect all JSONL files first, once each even if -projects-dir roots overlap
 	var jsonlFiles []string
-	err = filepath.WalkDir(projectsDir, func(path string, d os.DirEntry, err error) error {
-		if err != nil {
-			return err
-		}
+	seenFiles := make(map[string]bool)
+	for _, projectsDir := range projectsDirs {
+		err = filepath.WalkDir(projectsDir, func(path string, d os.DirEntry, err error) error {
+			if err != nil {
+				return err
+			}
 
-		if !d.IsDir() && strings.HasSuffix(d.Name(), ".jsonl") {
-			jsonlFiles = append(jsonlFiles, path)
-		}
+			if !d.IsDir() && strings.HasSuffix(d.Name(), ".jsonl") && !seenFiles[path] {
+				seenFiles[path] = true
+				jsonlFiles = append(jsonlFiles, path)
+			}
 
-		return nil
-	})
+			return nil
+		})
 
-	if err != nil && !os.IsNotExist(err) {
-		log.Fatalf("Error walking directory: %v", err)
+		if os.IsNotExist(err) {
+			if explicitProjectsDirs {
+				log.Printf("Warning: -projects-dir %s does not exist", projectsDir)
+			}
+		} else if err != nil {
+			log.Fatalf("Error walking directory: %v", err)
+		}
 	}
 
 	// Collect all OpenCode message files
@@ -1372,15 +4002,39 @@ func main() {
 		log.Printf("Warning: could not read opencode directory: %v", err)
 	}
 
-	// Load history files
-	historyFiles, err := ListHistoryFiles()
-	if err != nil {
-		log.Printf("Warning: could not list history files: %v", err)
+	// Load history files (unless -no-history skips history I/O entirely)
+	var historyFiles []string
+	if !*noHistory {
+		// Roll back a save that was interrupted partway through
+		if err := recoverInterruptedSave(); err != nil {
+			log.Printf("Warning: could not recover interrupted history save: %v", err)
+		}
+		historyFiles, err = ListHistoryFiles()
+		if err != nil {
+			log.Printf("Warning: could not list history files: %v", err)
+		}
+		for _, dir := range extraHistoryDirs {
+			files, err := ListHistoryFilesIn(dir)
+			if err != nil {
+				log.Printf("Warning: could not list history files in %s: %v", dir, err)
+				continue
+			}
+			historyFiles = append(historyFiles, files...)
+		}
+	}
+
+	// -since/-until skip history files outside the window entirely;
+	// saveToHistory loads UUIDs from any skipped file it needs for dedup.
+	// Note: -days still loads ALL history files.
+	if explicitRange {
+		queryEnd := rangeEnd
+		if queryEnd == 0 {
+			queryEnd = math.MaxInt64
+		}
+		historyFiles = FilterFilesForRange(historyFiles, rangeStart, queryEnd)
 	}
 
 	// Track which history files we've loaded (for dedup during save)
-	// Note: We load ALL history files (not filtered by --days) to ensure
-	// proper UUID deduplication when saving Claude records to history.
 	loadedHistoryFiles := make(map[string]bool)
 	for _, f := range historyFiles {
 		loadedHistoryFiles[f] = true
@@ -1391,6 +4045,103 @@ func main() {
 
 	// Get group configuration
 	cfg := getGroupConfig(groupBy)
+	if *showWeekday {
+		if groupBy != "day" {
+			log.Fatalf("-show-weekday requires the day grouping (table:day), not %s", groupBy)
+		}
+		cfg = withWeekdayColumn(cfg)
+	}
+	if *elapsedSince {
+		if groupBy != "day" {
+			log.Fatalf("-elapsed-since requires the day grouping (table:day), not %s", groupBy)
+		}
+		cfg = withElapsedColumn(cfg, time.Now().In(displayLocation))
+	}
+
+	if *fiscalStartFlag != "" {
+		fiscalStart, err = time.ParseInLocation("2006-01-02", *fiscalStartFlag, displayLocation)
+		if err != nil {
+			log.Fatalf("Invalid -fiscal-start: %v", err)
+		}
+	}
+	if groupBy == "fiscal-week" && fiscalStart.IsZero() {
+		log.Fatalf("fiscal-week grouping requires -fiscal-start YYYY-MM-DD")
+	}
+	if _, ok := projectionMethods[*projectMethod]; !ok {
+		log.Fatalf("Invalid -project-method: %s (valid: linear, trailing7, trailing30)", *projectMethod)
+	}
+	if *project && rangeStart > 0 {
+		// Days before the loaded range would count as $0 and drag the average down
+		loaded := time.Unix(rangeStart, 0).In(displayLocation)
+		if needed := projectionWindowStart(time.Now().In(displayLocation), *projectMethod); loaded.After(needed) {
+			log.Printf("Warning: -project-method %s averages from %s but records are only loaded from %s; widen -days or -since for a full window",
+				*projectMethod, needed.Format("2006-01-02"), loaded.Format("2006-01-02"))
+		}
+	}
+	if *annotateTier && groupBy != "model" {
+		log.Fatalf("-annotate-tier requires table:model grouping")
+	}
+	if *upgradeAdvice && groupBy != "model" {
+		log.Fatalf("-show-upgrade-advice requires table:model grouping")
+	}
+	if cacheBreakeven && groupBy != "model" {
+		log.Fatalf("-cache-breakeven requires table:model grouping")
+	}
+	if showBars && cfg.Hierarchical {
+		log.Fatalf("-bars requires a flat grouping (e.g. table:model), not %s", groupBy)
+	}
+	if cumulative && cfg.Hierarchical {
+		log.Fatalf("-cumulative requires a flat grouping (e.g. table:day, table:month), not %s", groupBy)
+	}
+	if relativeTo != "" && cfg.Hierarchical {
+		log.Fatalf("-relative-to requires a flat grouping (e.g. table:day), not %s", groupBy)
+	}
+	if *anomalySigma <= 0 {
+		log.Fatalf("Invalid -anomaly-sigma: %v (must be positive)", *anomalySigma)
+	}
+	if *streamJSON && outputKind != "json" {
+		log.Fatalf("-stream applies only to -o json[:group]")
+	}
+	if *includeUUIDColumn && outputKind != "csv-records" {
+		log.Fatalf("-include-uuid-column applies only to -o csv-records")
+	}
+	if summaryJSON && outputKind != "summary" {
+		log.Fatalf("-json applies to summary outputs (-o summary, totalcost, ...); use -o json[:group] for grouped JSON")
+	}
+	if totalPosition != "top" && totalPosition != "bottom" {
+		log.Fatalf("Invalid -total-position: %q (must be top or bottom)", totalPosition)
+	}
+	if familySubtotals && groupBy != "model" {
+		log.Fatalf("-family-subtotals requires the model grouping (table:model), not %s", groupBy)
+	}
+	if *mergeSimilarRows < 0 {
+		log.Fatalf("Invalid -merge-similar-rows: %v (must be a non-negative relative tolerance)", *mergeSimilarRows)
+	}
+	if *mergeSimilarRows > 0 && groupBy != "day" {
+		log.Fatalf("-merge-similar-rows requires the chronologically ordered day grouping (table:day), not %s", groupBy)
+	}
+	if *mergeSimilarRows > 0 && weekendsSeparate {
+		log.Fatalf("-merge-similar-rows can't be combined with -weekends-separate (merged ranges may span weekends)")
+	}
+	if weekendsSeparate && groupBy != "day" {
+		log.Fatalf("-weekends-separate requires the day grouping (table:day), not %s", groupBy)
+	}
+	// -span-weeks limits cyclical groupings to recent data
+	var spanCutoff time.Time
+	if *spanWeeks > 0 {
+		switch groupBy {
+		case "hour", "session-hour", "weekday":
+			spanCutoff = time.Now().AddDate(0, 0, -7*(*spanWeeks))
+		default:
+			log.Fatalf("-span-weeks requires an hour, session-hour or weekday grouping, not %s", groupBy)
+		}
+	}
+	dropBeforeFiscalStart := groupBy == "fiscal-week" && *fiscalDropBefore
+
+	if *dumpConfigFlag {
+		dumpConfig(os.Stdout, outputKind, groupBy, projectsDirs, extraHistoryDirs)
+		return
+	}
 
 	// Channel for cost records
 	costChan := make(chan CostRecord, 1000)
@@ -1398,19 +4149,17 @@ func main() {
 	// Start accumulator goroutine
 	var accWg sync.WaitGroup
 	accWg.Add(1)
-	metricsByGroup := make(map[string]Metrics)
-	var allRecords []CostRecord
+	var candidateRecords []CostRecord // Filtered records, before dedup
+	var allRecords []CostRecord       // Deduplicated records (after accWg.Wait)
+	var metricsByGroup map[string]Metrics
 	var claudeRecords []CostRecord             // Records from Claude logs (for saving to history)
 	historyUUIDs := make(map[string]bool)      // UUIDs already in history (for dedup)
 	var claudeMinTime, claudeMaxTime time.Time // Time range of Claude records
 	var claudeTimeInitialized bool
+	droppedFuture := 0 // Records dropped by -drop-future
+	futureCutoff := time.Now().Add(futureTolerance)
 	go func() {
 		defer accWg.Done()
-		// Track the maximum cost record for each requestID
-		maxCostByRequestID := make(map[string]CostRecord)
-		// Track seen usage keys (for records without requestID)
-		seenUsage := make(map[string]bool)
-
 		for record := range costChan {
 			// Track UUIDs from history files (for save dedup)
 			if record.FromHistory && record.UUID != "" {
@@ -1441,69 +4190,90 @@ func main() {
 					continue
 				}
 			}
+			// -since/-until drop undated records, which can't be placed in the window
+			if explicitRange {
+				ts := record.FullTimestamp
+				if ts.IsZero() || ts.Unix() < rangeStart || (rangeEnd != 0 && ts.Unix() >= rangeEnd) {
+					continue
+				}
+			}
+
+			// Skip future-dated records (clock skew) so they don't create phantom rows
+			if *dropFuture && record.FullTimestamp.After(futureCutoff) {
+				droppedFuture++
+				continue
+			}
+
+			// Skip records older than -span-weeks
+			if !spanCutoff.IsZero() && record.FullTimestamp.Before(spanCutoff) {
+				continue
+			}
+
+			// Skip records before the fiscal anchor if requested
+			if dropBeforeFiscalStart && fiscalWeekIndex(record.Timestamp) < 0 {
+				continue
+			}
 
 			// Skip records that don't match source filter
 			if *sourceFilter != "" && record.Source != *sourceFilter {
 				continue
 			}
 
-			// Metrics: dedupe by requestID (keep max cost) or UUID (for no-requestId records)
-			if record.RequestID != nil {
-				if existing, seen := maxCostByRequestID[*record.RequestID]; !seen {
-					maxCostByRequestID[*record.RequestID] = record
-				} else if record.Cost > existing.Cost {
-					maxCostByRequestID[*record.RequestID] = record
+			// Skip records outside -cwd; records without a directory never match
+			if *cwdFilter != "" && (record.Cwd == "" || !pathWithin(record.Cwd, *cwdFilter)) {
+				continue
+			}
+
+			// Skip records on other branches; an empty branch is "(none)" as in table:cwd,branch
+			if *branchFilter != "" {
+				branch := record.GitBranch
+				if branch == "" {
+					branch = "(none)"
 				}
-			} else {
-				// No requestId - dedupe by usage triplet (scoped to session).
-				// Some models split one API call into multiple JSONL entries (e.g.
-				// DeepSeek: thinking, text, tool_use each get a separate entry, all
-				// carrying the same usage stats). UUID dedup fails because each entry
-				// has a different UUID. The (cache_read, input, output) triplet is
-				// identical within a single API call's entries.
-				usageKey := fmt.Sprintf("%s:%d:%d:%d", record.SessionID, record.CacheReadTokens, record.InputTokens, record.OutputTokens)
-				if seenUsage[usageKey] {
+				if branch != *branchFilter {
 					continue
 				}
-				seenUsage[usageKey] = true
-
-				groupKey := cfg.BuildGroupKey(record)
-				m := metricsByGroup[groupKey]
-				m.Cost += record.Cost
-				m.InputTokens += record.InputTokens
-				m.OutputTokens += record.OutputTokens
-				m.CacheReadTokens += record.CacheReadTokens
-				m.CacheWriteTokens += record.CacheWriteTokens
-				m.InputCost += record.InputCost
-				m.OutputCost += record.OutputCost
-				m.CacheReadCost += record.CacheReadCost
-				m.CacheWriteCost += record.CacheWriteCost
-				metricsByGroup[groupKey] = m
-				allRecords = append(allRecords, record)
-			}
-		}
-
-		// Accumulate metrics for records with requestID
-		for _, record := range maxCostByRequestID {
-			groupKey := cfg.BuildGroupKey(record)
-			m := metricsByGroup[groupKey]
-			m.Cost += record.Cost
-			m.InputTokens += record.InputTokens
-			m.OutputTokens += record.OutputTokens
-			m.CacheReadTokens += record.CacheReadTokens
-			m.CacheWriteTokens += record.CacheWriteTokens
-			m.InputCost += record.InputCost
-			m.OutputCost += record.OutputCost
-			m.CacheReadCost += record.CacheReadCost
-			m.CacheWriteCost += record.CacheWriteCost
-			metricsByGroup[groupKey] = m
-			allRecords = append(allRecords, record)
+			}
+
+			// Skip records outside -model. This runs before DedupRecords so a
+			// dropped record never competes with a kept one for its requestID.
+			if len(modelFilter) > 0 && !modelFilter[record.PricingKey] {
+				continue
+			}
+
+			// Fold models outside the allowlist into a single bucket
+			if len(allowedModels) > 0 && !allowedModels[record.PricingKey] {
+				record.PricingKey = "(excluded)"
+			}
+
+			// Dedup happens once all records are in (see DedupRecords)
+			candidateRecords = append(candidateRecords, record)
 		}
 	}()
 
 	// Global channel for lines to parse
 	lineChan := make(chan LineWork, 1000)
 
+	// Per-history-file line counts (only tracked for -partial-line-report)
+	var lineCountsMu sync.Mutex
+	historyLineCounts := make(map[string]*LineCounts)
+	countHistoryLine := func(work LineWork, corrupt bool) {
+		if !*partialLineReport || !work.FromHistory {
+			return
+		}
+		lineCountsMu.Lock()
+		defer lineCountsMu.Unlock()
+		counts := historyLineCounts[work.Path]
+		if counts == nil {
+			counts = &LineCounts{}
+			historyLineCounts[work.Path] = counts
+		}
+		counts.Total++
+		if corrupt {
+			counts.Corrupt++
+		}
+	}
+
 	// Start global worker pool for parsing lines
 	var lineWg sync.WaitGroup
 	numLineWorkers := runtime.NumCPU()
@@ -1513,8 +4283,10 @@ func main() {
 				var entry ConversationEntry
 				if err := json.Unmarshal(work.Line, &entry); err != nil {
 					// Skip corrupted/partial lines (expected for history files after crash)
+					countHistoryLine(work, true)
 					continue
 				}
+				countHistoryLine(work, false)
 
 				// Calculate cost and get pricing key
 				cost, inputTokens, outputTokens, cacheReadTokens, cacheWriteTokens, inputCost, outputCost, cacheReadCost, cacheWriteCost, pricingKey := CalculateCost(&entry.Message, entry.Timestamp)
@@ -1523,32 +4295,43 @@ func main() {
 				if pricingKey == "" {
 					continue
 				}
+				cache5mTokens, cache1hTokens, cache5mCost, cache1hCost := SplitCacheWrite(&entry.Message, entry.Timestamp, cacheWriteCost)
+				// Unknown models come back keyed by their raw name; zero-usage
+				// entries (e.g. "<synthetic>" error messages) cost nothing anyway
+				_, priced := modelPricing[pricingKey]
+				unpriced := !priced && inputTokens+outputTokens+cacheReadTokens+cacheWriteTokens > 0
 
-				localTime := entry.Timestamp.Local()
+				localTime := entry.Timestamp.In(displayLocation)
 				record := CostRecord{
-					UUID:             entry.UUID,
-					RequestID:        entry.RequestID,
-					SessionID:        entry.SessionID,
-					Cost:             cost,
-					InputTokens:      inputTokens,
-					OutputTokens:     outputTokens,
-					CacheReadTokens:  cacheReadTokens,
-					CacheWriteTokens: cacheWriteTokens,
-					InputCost:        inputCost,
-					OutputCost:       outputCost,
-					CacheReadCost:    cacheReadCost,
-					CacheWriteCost:   cacheWriteCost,
-					PricingKey:       pricingKey,
-					Timestamp:        localTime.Format("2006-01-02"),
-					FullTimestamp:    localTime,
-					Hour:             localTime.Hour(),
-					Weekday:          localTime.Weekday().String()[:3],
-					Cwd:              entry.CWD,
-					GitBranch:        entry.GitBranch,
-					FromHistory:      work.FromHistory,
-					RawLine:          work.Line, // Keep raw line for saving to history
-					Source:           string(SourceClaude),
-					ProviderID:       "anthropic",
+					UUID:               entry.UUID,
+					RequestID:          entry.RequestID,
+					SessionID:          entry.SessionID,
+					ServiceTier:        entry.Message.Usage.ServiceTier,
+					Cost:               cost,
+					InputTokens:        inputTokens,
+					OutputTokens:       outputTokens,
+					CacheReadTokens:    cacheReadTokens,
+					CacheWriteTokens:   cacheWriteTokens,
+					InputCost:          inputCost,
+					OutputCost:         outputCost,
+					CacheReadCost:      cacheReadCost,
+					CacheWriteCost:     cacheWriteCost,
+					CacheWrite5mTokens: cache5mTokens,
+					CacheWrite1hTokens: cache1hTokens,
+					CacheWrite5mCost:   cache5mCost,
+					CacheWrite1hCost:   cache1hCost,
+					PricingKey:         pricingKey,
+					Timestamp:          localTime.Format("2006-01-02"),
+					FullTimestamp:      localTime,
+					Hour:               localTime.Hour(),
+					Weekday:            localTime.Weekday().String(),
+					Cwd:                entry.CWD,
+					GitBranch:          entry.GitBranch,
+					FromHistory:        work.FromHistory,
+					RawLine:            work.Line, // Keep raw line for saving to history
+					Source:             string(SourceClaude),
+					ProviderID:         "anthropic",
+					Unpriced:           unpriced,
 				}
 				costChan <- record
 			}
@@ -1623,27 +4406,181 @@ func main() {
 	close(costChan)
 	accWg.Wait()
 
+	allRecords = DedupRecords(candidateRecords)
+	if len(excludedDates) > 0 {
+		var excluded Metrics
+		allRecords = slices.DeleteFunc(allRecords, func(record CostRecord) bool {
+			if excludedDates[record.Timestamp] {
+				excluded.AddRecord(record)
+				return true
+			}
+			return false
+		})
+		log.Printf("Excluded %d records (%s) on -exclude-dates days", excluded.Requests, formatCost(excluded.Cost))
+	}
+	metricsByGroup, _ = Aggregate(allRecords, cfg)
+
+	if droppedFuture > 0 {
+		log.Printf("Warning: dropped %d records timestamped more than %v in the future (clock skew?); use -drop-future=false to keep them", droppedFuture, futureTolerance)
+	}
+
 	// Save new Claude records to history
-	if err := saveToHistory(claudeRecords, historyUUIDs, loadedHistoryFiles, claudeMinTime, claudeMaxTime); err != nil {
-		log.Printf("Warning: could not save to history: %v", err)
+	if !*noHistory {
+		if err := saveToHistory(claudeRecords, historyUUIDs, loadedHistoryFiles, claudeMinTime, claudeMaxTime); err != nil {
+			log.Printf("Warning: could not save to history: %v", err)
+		}
+	}
+
+	// Checked before anything is rendered, pushed or exported, so -strict
+	// never publishes totals that count unknown models at $0
+	if unpriced := tallyUnpricedModels(allRecords); len(unpriced) > 0 {
+		if *strict {
+			log.Fatalf("Error: %s (-strict)", formatUnpricedModels(unpriced))
+		}
+		log.Printf("Warning: %s", formatUnpricedModels(unpriced))
+	}
+
+	// Pick the output destination
+	var w io.Writer = os.Stdout
+	var outFile *os.File
+	if *outputFile != "" {
+		var err error
+		outFile, err = openOutputFile(*outputFile, *appendSnapshots)
+		if err != nil {
+			log.Fatalf("Could not open output file: %v", err)
+		}
+		w = outFile
+	}
+
+	if *minTokens > 0 {
+		foldSmallGroups(metricsByGroup, cfg, *minTokens)
+	}
+
+	if *fillEmptyDaysFlag && groupBy == "day" {
+		var start time.Time
+		if rangeStart > 0 {
+			start = time.Unix(rangeStart, 0).In(displayLocation)
+		}
+		end := time.Now().In(displayLocation)
+		if rangeEnd != 0 {
+			end = time.Unix(rangeEnd, 0).In(displayLocation).AddDate(0, 0, -1)
+		}
+		fillEmptyDays(metricsByGroup, start, end)
+		// Excluded days stay out rather than showing as inactive
+		for date := range excludedDates {
+			delete(metricsByGroup, date)
+		}
+	}
+
+	if *mergeSimilarRows > 0 {
+		mergeSimilarDays(metricsByGroup, *mergeSimilarRows)
+	}
+
+	if *top > 0 {
+		foldToTop(metricsByGroup, cfg, *top)
+	}
+
+	if *annotateTier {
+		labelAnnotations = longContextAnnotations(metricsByGroup)
+	}
+	if *upgradeAdvice {
+		if labelAnnotations == nil {
+			labelAnnotations = make(map[string]string)
+		}
+		for key, note := range upgradeAnnotations(metricsByGroup) {
+			if existing, ok := labelAnnotations[key]; ok {
+				note = existing + " " + note
+			}
+			labelAnnotations[key] = note
+		}
+	}
+
+	if *highlightAnomalies {
+		anomalousGroups = findAnomalies(metricsByGroup, *anomalySigma)
+	}
+
+	// Collect and sort keys
+	var keys []string
+	for key := range metricsByGroup {
+		keys = append(keys, key)
+	}
+	sortKeys(keys, cfg)
+	if *sortBy != "label" || *reverseSort {
+		sortKeysByMetric(keys, cfg, metricsByGroup, *sortBy, *reverseSort)
 	}
 
 	// Render output based on format
-	if outputKind == "summary" {
+	switch outputKind {
+	case "summary":
 		// Render summary using template
-		if err := renderSummary(metricsByGroup, templateStr, allRecords); err != nil {
+		var summaryStart, summaryEnd time.Time
+		if rangeStart > 0 {
+			summaryStart, summaryEnd = time.Unix(rangeStart, 0), time.Now()
+		}
+		if rangeEnd != 0 {
+			summaryEnd = time.Unix(rangeEnd, 0)
+		}
+		if err := renderSummary(w, metricsByGroup, templateStr, allRecords, summaryStart, summaryEnd); err != nil {
 			log.Fatalf("Error rendering summary: %v", err)
 		}
-	} else {
-		// Collect and sort keys
-		var keys []string
-		for key := range metricsByGroup {
-			keys = append(keys, key)
+	case "prometheus":
+		renderPrometheus(w, cfg, keys, metricsByGroup)
+	case "gnuplot":
+		renderGnuplot(w, cfg, keys, metricsByGroup)
+	case "json":
+		render := renderJSON
+		if *streamJSON {
+			render = renderJSONStream
+		}
+		if err := render(w, cfg, keys, metricsByGroup); err != nil {
+			log.Fatalf("Error writing JSON: %v", err)
+		}
+	case "markdown":
+		renderMarkdown(w, cfg, keys, metricsByGroup)
+	case "csv":
+		if err := renderCSV(w, cfg, keys, metricsByGroup); err != nil {
+			log.Fatalf("Error writing CSV: %v", err)
+		}
+	case "csv-records":
+		if err := renderCSVRecords(w, allRecords, *includeUUIDColumn); err != nil {
+			log.Fatalf("Error writing CSV: %v", err)
+		}
+	default:
+		if alertWindow > 0 {
+			renderAlertBanner(w, allRecords, alertThreshold, alertWindow)
 		}
-		sortKeys(keys, cfg)
 
 		// Render table
-		renderTable(cfg, keys, metricsByGroup)
+		renderTable(w, cfg, keys, metricsByGroup)
+
+		if *project {
+			renderProjection(w, allRecords, *projectMethod)
+		}
+	}
+
+	// Close explicitly: a failed close can mean the output never reached disk
+	if outFile != nil {
+		if err := outFile.Close(); err != nil {
+			log.Fatalf("Could not write output file: %v", err)
+		}
+	}
+
+	if *pushGateway != "" {
+		var body bytes.Buffer
+		renderPrometheus(&body, cfg, keys, metricsByGroup)
+		if err := pushToGateway(*pushGateway, *pushJob, body.Bytes()); err != nil {
+			log.Fatalf("Error pushing metrics: %v", err)
+		}
+	}
+
+	if *exportSQLitePath != "" {
+		if _, err := exportSQLite(*exportSQLitePath, allRecords); err != nil {
+			log.Fatalf("Error exporting to SQLite: %v", err)
+		}
+	}
+
+	if *partialLineReport {
+		printPartialLineReport(os.Stderr, historyLineCounts)
 	}
 
 	// Memory profiling
@@ -1660,6 +4597,130 @@ func main() {
 	}
 }
 
+// printPartialLineReport prints per-history-file counts of lines that failed to
+// parse. A high count in a recent file suggests a write bug rather than the
+// occasional torn line left by a crash.
+func printPartialLineReport(w io.Writer, counts map[string]*LineCounts) {
+	totalLines, corruptLines, corruptFiles := 0, 0, 0
+	for _, path := range slices.Sorted(maps.Keys(counts)) {
+		c := counts[path]
+		totalLines += c.Total
+		corruptLines += c.Corrupt
+		if c.Corrupt == 0 {
+			continue
+		}
+		corruptFiles++
+		fmt.Fprintf(w, "%s: %d of %d lines un-parseable\n", filepath.Base(path), c.Corrupt, c.Total)
+	}
+	fmt.Fprintf(w, "Partial line report: %d un-parseable of %d lines in %d history files (%d affected)\n",
+		corruptLines, totalLines, len(counts), corruptFiles)
+}
+
+// unpricedModel tallies the records of one model with no known pricing
+type unpricedModel struct {
+	Model   string
+	Entries int
+	Tokens  int
+}
+
+// tallyUnpricedModels counts the entries and tokens of each unpriced model in
+// records, most entries first
+func tallyUnpricedModels(records []CostRecord) []unpricedModel {
+	byModel := make(map[string]*unpricedModel)
+	for _, record := range records {
+		if !record.Unpriced {
+			continue
+		}
+		u, ok := byModel[record.PricingKey]
+		if !ok {
+			u = &unpricedModel{Model: record.PricingKey}
+			byModel[record.PricingKey] = u
+		}
+		u.Entries++
+		u.Tokens += record.InputTokens + record.OutputTokens + record.CacheReadTokens + record.CacheWriteTokens
+	}
+
+	var tally []unpricedModel
+	for _, u := range byModel {
+		tally = append(tally, *u)
+	}
+	slices.SortFunc(tally, func(a, b unpricedModel) int {
+		return cmp.Or(cmp.Compare(b.Entries, a.Entries), cmp.Compare(a.Model, b.Model))
+	})
+	return tally
+}
+
+// formatUnpricedModels describes an unpriced model tally, e.g.
+// "12 entries from unknown models counted at $0: claude-foo-1 (12 entries, 1.2m tokens)"
+func formatUnpricedModels(tally []unpricedModel) string {
+	entries := 0
+	models := make([]string, len(tally))
+	for i, u := range tally {
+		entries += u.Entries
+		models[i] = fmt.Sprintf("%s (%d entries, %s tokens)", u.Model, u.Entries, formatTokens(u.Tokens))
+	}
+	return fmt.Sprintf("%d entries from unknown models counted at $0: %s", entries, strings.Join(models, ", "))
+}
+
+// dumpConfig prints the effective settings as "key = value" lines: values
+// resolved from flags and the environment first, then every flag as parsed.
+func dumpConfig(w io.Writer, outputKind, groupBy string, projectsDirs, extraHistoryDirs []string) {
+	historyDir, err := HistoryDir()
+	if err != nil {
+		historyDir = fmt.Sprintf("(error: %v)", err)
+	}
+
+	fmt.Fprintf(w, "output.kind = %s\n", outputKind)
+	fmt.Fprintf(w, "output.grouping = %s\n", groupBy)
+	fmt.Fprintf(w, "timezone = %s\n", displayLocation)
+	fmt.Fprintf(w, "color = %t\n", !noColor)
+	fmt.Fprintf(w, "projects.dirs = %s\n", strings.Join(projectsDirs, ","))
+	fmt.Fprintf(w, "history.dir = %s\n", historyDir)
+	fmt.Fprintf(w, "history.extra_dirs = %s\n", strings.Join(extraHistoryDirs, ","))
+	if !fiscalStart.IsZero() {
+		fmt.Fprintf(w, "fiscal.start = %s\n", fiscalStart.Format("2006-01-02"))
+	}
+
+	flag.VisitAll(func(f *flag.Flag) {
+		fmt.Fprintf(w, "flag.%s = %s\n", f.Name, f.Value.String())
+	})
+}
+
+// openOutputFile opens the -output-file destination for a single render.
+// By default the file is truncated so it always holds just the latest render.
+// With appendSnapshots, the file is opened for append and a timestamp header
+// is written so successive renders form a time series in one file.
+func openOutputFile(path string, appendSnapshots bool) (*os.File, error) {
+	if !appendSnapshots {
+		return os.Create(path)
+	}
+
+	f, err := os.OpenFile(path, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0644)
+	if err != nil {
+		return nil, err
+	}
+	if _, err := fmt.Fprintf(f, "# %s\n", time.Now().Format(time.RFC3339)); err != nil {
+		f.Close()
+		return nil, err
+	}
+	return f, nil
+}
+
+// recoverInterruptedSave rolls back a history save that was interrupted
+// partway through (see RecoverHistoryJournal), logging what it removed. Run it
+// before anything reads or rewrites history files: the journal's offsets only
+// describe the files as the interrupted save left them.
+func recoverInterruptedSave() error {
+	dropped, err := RecoverHistoryJournal()
+	if err != nil {
+		return err
+	}
+	if dropped > 0 {
+		log.Printf("Recovered interrupted history save: removed %d partially saved lines", dropped)
+	}
+	return nil
+}
+
 // saveToHistory saves new Claude records to history files with deduplication
 func saveToHistory(claudeRecords []CostRecord, historyUUIDs map[string]bool, loadedHistoryFiles map[string]bool, claudeMinTime, claudeMaxTime time.Time) error {
 	if len(claudeRecords) == 0 {
@@ -1703,11 +4764,15 @@ func saveToHistory(claudeRecords []CostRecord, historyUUIDs map[string]bool, loa
 			continue
 		}
 
+		// History files are always bucketed by local day, even with -utc
+		record.FullTimestamp = record.FullTimestamp.Local()
 		date := record.FullTimestamp.Format("2006-01-02")
 		recordsByDate[date] = append(recordsByDate[date], record)
 	}
 
-	// Save each date's records to the appropriate history file
+	// Save each date's records to the appropriate history file, as one
+	// journaled batch so an interrupted save is rolled back next run
+	var appends []HistoryAppend
 	for _, records := range recordsByDate {
 		if len(records) == 0 {
 			continue
@@ -1721,18 +4786,14 @@ func saveToHistory(claudeRecords []CostRecord, historyUUIDs map[string]bool, loa
 		}
 
 		// Collect raw lines
-		var lines [][]byte
+		a := HistoryAppend{File: histFile}
 		for _, r := range records {
-			lines = append(lines, r.RawLine)
-		}
-
-		// Append to history file
-		if err := AppendRawLines(histFile, lines); err != nil {
-			log.Printf("Warning: could not append to history file %s: %v", histFile, err)
+			a.Lines = append(a.Lines, r.RawLine)
 		}
+		appends = append(appends, a)
 	}
 
-	return nil
+	return AppendHistoryBatch(appends)
 }
 
 func processJSONLFile(path string, lineChan chan<- LineWork, buffer []byte, fromHistory bool) error {
@@ -1756,7 +4817,7 @@ func processJSONLFile(path string, lineChan chan<- LineWork, buffer []byte, from
 		// Make a copy of the line since scanner reuses the buffer
 		lineCopy := make([]byte, len(line))
 		copy(lineCopy, line)
-		lineChan <- LineWork{Line: lineCopy, FromHistory: fromHistory}
+		lineChan <- LineWork{Line: lineCopy, FromHistory: fromHistory, Path: path}
 	}
 
 	if err := scanner.Err(); err != nil {
@@ -1799,7 +4860,7 @@ func processOpenCodeFile(path string) (*CostRecord, error) {
 	timestamp := time.UnixMilli(msg.Time.Created)
 
 	// Calculate cost using dynamic pricing (OpenRouter fallback)
-	totalCost, inputCost, outputCost, cacheReadCost, cacheWriteCost, pricingKey, _ := CalculateCostWithDynamicPricing(
+	totalCost, inputCost, outputCost, cacheReadCost, cacheWriteCost, pricingKey, usedOpenRouter := CalculateCostWithDynamicPricing(
 		msg.ModelID,
 		inputTokens,
 		outputTokens,
@@ -1812,7 +4873,9 @@ func processOpenCodeFile(path string) (*CostRecord, error) {
 	if pricingKey == "" {
 		pricingKey = msg.ModelID
 	}
-	localTime := timestamp.Local()
+	_, priced := modelPricing[pricingKey]
+	unpriced := !priced && !usedOpenRouter
+	localTime := timestamp.In(displayLocation)
 
 	record := &CostRecord{
 		UUID:             msg.ID,
@@ -1826,14 +4889,18 @@ func processOpenCodeFile(path string) (*CostRecord, error) {
 		OutputCost:       outputCost,
 		CacheReadCost:    cacheReadCost,
 		CacheWriteCost:   cacheWriteCost,
-		PricingKey:       pricingKey,
-		Timestamp:        localTime.Format("2006-01-02"),
-		FullTimestamp:    localTime,
-		Hour:             localTime.Hour(),
-		Weekday:          localTime.Weekday().String()[:3],
-		Cwd:              msg.Path.Cwd,
-		Source:           string(SourceOpenCode),
-		ProviderID:       msg.ProviderID,
+		// OpenCode reports no cache TTL; count writes at the default 5m
+		CacheWrite5mTokens: cacheWriteTokens,
+		CacheWrite5mCost:   cacheWriteCost,
+		PricingKey:         pricingKey,
+		Timestamp:          localTime.Format("2006-01-02"),
+		FullTimestamp:      localTime,
+		Hour:               localTime.Hour(),
+		Weekday:            localTime.Weekday().String(),
+		Cwd:                msg.Path.Cwd,
+		Source:             string(SourceOpenCode),
+		ProviderID:         msg.ProviderID,
+		Unpriced:           unpriced,
 	}
 
 	return record, nil
@@ -0,0 +1,75 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"strings"
+)
+
+// markdownCell escapes a value for a GitHub-flavored Markdown table cell
+func markdownCell(value string) string {
+	return strings.ReplaceAll(value, "|", `\|`)
+}
+
+// markdownMetricCell formats tokens and cost for one Markdown cell
+func markdownMetricCell(tokens int, cost float64) string {
+	return formatTokens(tokens) + " " + formatCost(cost)
+}
+
+// markdownMetrics returns the breakdown cells (in display order, honoring
+// -column-order and -hide-columns) followed by the Total cell
+func markdownMetrics(m Metrics) []string {
+	tokens := []int{m.InputTokens, m.OutputTokens, m.CacheReadTokens, m.CacheWriteTokens}
+	costs := []float64{m.InputCost, m.OutputCost, m.CacheReadCost, m.CacheWriteCost}
+	var cells []string
+	for _, col := range metricColumns {
+		if !hiddenColumns[col.Name] {
+			cells = append(cells, markdownMetricCell(tokens[col.Cell], costs[col.Cell]))
+		}
+	}
+	totalTokens := m.InputTokens + m.OutputTokens + m.CacheReadTokens + m.CacheWriteTokens
+	return append(cells, markdownMetricCell(totalTokens, m.Cost))
+}
+
+// renderMarkdown writes a GitHub-flavored Markdown table without color:
+// left-aligned label columns, right-aligned metric columns, one row per group
+// and the grand total as the last row.
+func renderMarkdown(w io.Writer, cfg GroupConfig, keys []string, metricsByGroup map[string]Metrics) {
+	writeRow := func(cells []string) {
+		fmt.Fprintf(w, "| %s |\n", strings.Join(cells, " | "))
+	}
+
+	header := append([]string{}, cfg.LabelColumns...)
+	separator := make([]string, 0, len(cfg.LabelColumns)+len(metricColumns)+1)
+	for range cfg.LabelColumns {
+		separator = append(separator, ":---")
+	}
+	for _, col := range metricColumns {
+		if !hiddenColumns[col.Name] {
+			header = append(header, col.Header)
+			separator = append(separator, "---:")
+		}
+	}
+	header = append(header, "Total")
+	separator = append(separator, "---:")
+	writeRow(header)
+	writeRow(separator)
+
+	total := Metrics{}
+	for _, key := range keys {
+		m := metricsByGroup[key]
+		total.Add(m)
+		var labels []string
+		for _, label := range displayLabels(cfg, key) {
+			labels = append(labels, markdownCell(label))
+		}
+		writeRow(append(labels, markdownMetrics(m)...))
+	}
+
+	if noFooter {
+		return
+	}
+	totalLabels := make([]string, len(cfg.LabelColumns))
+	totalLabels[0] = "**Total**"
+	writeRow(append(totalLabels, markdownMetrics(total)...))
+}
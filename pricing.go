@@ -1,25 +1,30 @@
 package main
 
 import (
+	"bytes"
 	"encoding/json"
 	"fmt"
 	"io"
+	"maps"
 	"net/http"
 	"os"
 	"path/filepath"
+	"slices"
 	"strconv"
 	"strings"
 	"sync"
 	"time"
 )
 
-// ModelPricing represents the pricing for a model in dollars per million tokens
+// ModelPricing represents the pricing for a model in dollars per million tokens.
+// Every rate is used as-is: in particular the 1h cache write rate is never
+// derived from the input or 5m rates, so each entry must carry its own.
 type ModelPricing struct {
-	Input        float64 // Base input tokens
-	Cache5mWrite float64 // 5m cache writes
-	Cache1hWrite float64 // 1h cache writes
-	CacheRead    float64 // Cache hits & refreshes
-	Output       float64 // Output tokens
+	Input        float64 `json:"input"`          // Base input tokens
+	Cache5mWrite float64 `json:"cache_5m_write"` // 5m cache writes
+	Cache1hWrite float64 `json:"cache_1h_write"` // 1h cache writes (published rate, not derived)
+	CacheRead    float64 `json:"cache_read"`     // Cache hits & refreshes
+	Output       float64 `json:"output"`         // Output tokens
 }
 
 // Pricing table for Claude model families (per million tokens)
@@ -69,7 +74,7 @@ var modelPricing = map[string]ModelPricing{
 	"opus-4.5": {
 		Input:        5.00,
 		Cache5mWrite: 6.25,
-		Cache1hWrite: 10.00, // 2× input, following standard pattern
+		Cache1hWrite: 10.00,
 		CacheRead:    0.50,
 		Output:       25.00,
 	},
@@ -89,9 +94,9 @@ var modelPricing = map[string]ModelPricing{
 	},
 	"sonnet-longcontext": {
 		Input:        6.00,
-		Cache5mWrite: 7.50,  // Proportionally scaled
-		Cache1hWrite: 12.00, // Proportionally scaled
-		CacheRead:    0.60,  // Proportionally scaled
+		Cache5mWrite: 7.50,
+		Cache1hWrite: 12.00,
+		CacheRead:    0.60,
 		Output:       22.50,
 	},
 	"haiku-4.5": {
@@ -101,6 +106,13 @@ var modelPricing = map[string]ModelPricing{
 		CacheRead:    0.10,
 		Output:       5.00,
 	},
+	"haiku-4": {
+		Input:        1.00, // Priced like Haiku 4.5
+		Cache5mWrite: 1.25,
+		Cache1hWrite: 2.00,
+		CacheRead:    0.10,
+		Output:       5.00,
+	},
 	"haiku-3.5": {
 		Input:        0.80,
 		Cache5mWrite: 1.00,
@@ -148,6 +160,224 @@ var modelPricing = map[string]ModelPricing{
 	},
 }
 
+// configPricingKeys are pricing keys added (not just overridden) by the
+// pricing config file, lowercased. Model names matching one, ignoring case,
+// use its rates.
+var configPricingKeys = map[string]bool{}
+
+// PricingConfigPath returns the XDG-compliant path of the optional pricing
+// overrides file: $XDG_CONFIG_HOME/ccc/pricing.json or ~/.config/ccc/pricing.json
+func PricingConfigPath() (string, error) {
+	configHome := os.Getenv("XDG_CONFIG_HOME")
+	if configHome == "" {
+		home, err := os.UserHomeDir()
+		if err != nil {
+			return "", err
+		}
+		configHome = filepath.Join(home, ".config")
+	}
+	return filepath.Join(configHome, "ccc", "pricing.json"), nil
+}
+
+// pricingOverride is one rate in the pricing config file. EffectiveFrom, a
+// YYYY-MM-DD date (UTC), makes it a price change: usage before it keeps the
+// rate it replaces.
+type pricingOverride struct {
+	ModelPricing
+	EffectiveFrom string `json:"effective_from"`
+}
+
+// LoadPricingOverrides merges the pricing config file at path over
+// modelPricing. The file maps pricing keys to rates in dollars per million
+// tokens, e.g. {"opus-4.8": {"output": 20}}; fields left out keep the built-in
+// rate, and unknown keys add a model. Keys are matched case-insensitively, as
+// model names are. A key may instead map to a list of rates, oldest first, to
+// record price changes: every rate but an undated first one needs
+// "effective_from", and each fills its left-out fields from the one before.
+// Rates replaced by a dated one move to pricingHistory. Nothing is applied
+// unless the whole file is valid. A missing file is not an error. Returns the
+// number of keys merged.
+func LoadPricingOverrides(path string) (int, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return 0, nil
+		}
+		return 0, err
+	}
+
+	var entries map[string]json.RawMessage
+	if err := json.Unmarshal(data, &entries); err != nil {
+		return 0, err
+	}
+	merged := make(map[string]ModelPricing, len(entries))
+	superseded := make(map[string][]pricingPeriod)
+	for name, raw := range entries {
+		key := strings.ToLower(name)
+		if _, dup := merged[key]; dup {
+			return 0, fmt.Errorf("%s: pricing key appears more than once (keys are case-insensitive)", key)
+		}
+		rates := []json.RawMessage{raw}
+		if trimmed := bytes.TrimSpace(raw); len(trimmed) > 0 && trimmed[0] == '[' {
+			if err := json.Unmarshal(raw, &rates); err != nil {
+				return 0, fmt.Errorf("%s: %w", key, err)
+			}
+			if len(rates) == 0 {
+				return 0, fmt.Errorf("%s: empty list of rates", key)
+			}
+		}
+
+		pricing, known := modelPricing[key]
+		var last time.Time // When the latest rate so far took effect
+		if history := pricingHistory[key]; len(history) > 0 {
+			last = history[len(history)-1].Until
+		}
+		for i, rate := range rates {
+			override := pricingOverride{ModelPricing: pricing}
+			dec := json.NewDecoder(bytes.NewReader(rate))
+			dec.DisallowUnknownFields()
+			if err := dec.Decode(&override); err != nil {
+				return 0, fmt.Errorf("%s: rate %d: %w", key, i+1, err)
+			}
+			p := override.ModelPricing
+			if p.Input < 0 || p.Cache5mWrite < 0 || p.Cache1hWrite < 0 || p.CacheRead < 0 || p.Output < 0 {
+				return 0, fmt.Errorf("%s: rate %d: rates must not be negative", key, i+1)
+			}
+			if override.EffectiveFrom == "" {
+				if i > 0 {
+					return 0, fmt.Errorf("%s: rate %d: effective_from is required after the first rate", key, i+1)
+				}
+				pricing, known = p, true
+				continue
+			}
+			from, err := time.Parse(time.DateOnly, override.EffectiveFrom)
+			if err != nil {
+				return 0, fmt.Errorf("%s: rate %d: effective_from: want YYYY-MM-DD: %w", key, i+1, err)
+			}
+			if !known {
+				return 0, fmt.Errorf("%s: rate %d: effective_from needs an earlier rate to supersede", key, i+1)
+			}
+			if !from.After(last) {
+				return 0, fmt.Errorf("%s: rate %d: effective_from %s is not after the previous price change on %s", key, i+1, override.EffectiveFrom, last.Format(time.DateOnly))
+			}
+			superseded[key] = append(superseded[key], pricingPeriod{Until: from, Pricing: pricing})
+			pricing, last = p, from
+		}
+		merged[key] = pricing
+	}
+
+	for key, pricing := range merged {
+		if _, ok := modelPricing[key]; !ok {
+			configPricingKeys[key] = true
+		}
+		if periods := superseded[key]; len(periods) > 0 {
+			pricingHistory[key] = append(pricingHistory[key], periods...)
+		}
+		modelPricing[key] = pricing
+	}
+	return len(merged), nil
+}
+
+// pricingPeriod is a rate that applied to a pricing key until a price change
+type pricingPeriod struct {
+	Until   time.Time // First instant the next period (or modelPricing) applies
+	Pricing ModelPricing
+}
+
+// pricingHistory holds superseded rates per pricing key, oldest first, so
+// historical usage is priced at the rate in effect when it happened.
+// modelPricing always holds the current rates; keys whose price never
+// changed have no entry here. No built-in rate has changed yet: entries come
+// from dated rates in the pricing config.
+var pricingHistory = map[string][]pricingPeriod{}
+
+// pricingAt returns the rate for pricingKey in effect at timestamp: the first
+// superseded period that hadn't ended yet, or current otherwise.
+func pricingAt(pricingKey string, current ModelPricing, timestamp time.Time) ModelPricing {
+	for _, period := range pricingHistory[pricingKey] {
+		if timestamp.Before(period.Until) {
+			return period.Pricing
+		}
+	}
+	return current
+}
+
+// modelSuccessors maps pricing keys to a newer model in the same family that
+// is cheaper, for -show-upgrade-advice. Same-price successors aren't listed.
+var modelSuccessors = map[string]string{
+	"opus": "opus-4.8",
+}
+
+// CacheReadSavings returns how much a record's cache reads saved versus paying
+// the input rate for the same tokens, at the rates in effect for the record
+// and its service tier. Records without built-in pricing save nothing.
+func CacheReadSavings(record CostRecord) float64 {
+	current, ok := modelPricing[record.PricingKey]
+	if !ok || record.CacheReadTokens == 0 {
+		return 0
+	}
+	pricing := pricingAt(record.PricingKey, current, record.FullTimestamp)
+	savings := float64(record.CacheReadTokens) / 1_000_000.0 * (pricing.Input - pricing.CacheRead)
+	if multiplier, ok := serviceTierMultipliers[record.ServiceTier]; ok {
+		savings *= multiplier
+	}
+	return savings
+}
+
+// RecordUpgradeSavings returns how much less a record would have cost on its
+// model's successor (see modelSuccessors). Both models are priced from the
+// record's tokens at the rates in effect for the record, with 5m and 1h cache
+// writes at their own rates and the record's service tier applied to both.
+func RecordUpgradeSavings(record CostRecord) float64 {
+	successor, ok := modelSuccessors[record.PricingKey]
+	if !ok {
+		return 0
+	}
+	current, ok := modelPricing[record.PricingKey]
+	next, nextOK := modelPricing[successor]
+	if !ok || !nextOK {
+		return 0
+	}
+	from := pricingAt(record.PricingKey, current, record.FullTimestamp)
+	to := pricingAt(successor, next, record.FullTimestamp)
+	savings := (float64(record.InputTokens)*(from.Input-to.Input) +
+		float64(record.OutputTokens)*(from.Output-to.Output) +
+		float64(record.CacheReadTokens)*(from.CacheRead-to.CacheRead) +
+		float64(record.CacheWrite5mTokens)*(from.Cache5mWrite-to.Cache5mWrite) +
+		float64(record.CacheWrite1hTokens)*(from.Cache1hWrite-to.Cache1hWrite)) / 1_000_000.0
+	if multiplier, ok := serviceTierMultipliers[record.ServiceTier]; ok {
+		savings *= multiplier
+	}
+	return savings
+}
+
+// UpgradeSavings returns the successor of pricingKey and how much less the
+// usage in m would have cost on it, as summed per record by RecordUpgradeSavings
+func UpgradeSavings(pricingKey string, m Metrics) (string, float64, bool) {
+	successor, ok := modelSuccessors[pricingKey]
+	if !ok {
+		return "", 0, false
+	}
+	return successor, m.UpgradeSavings, true
+}
+
+// pricingTableProblems reports modelPricing entries whose cache write rates
+// are inconsistent: a 5m rate without a 1h rate would price 1h writes at $0,
+// and a 1h rate below the 5m rate contradicts every published price list.
+func pricingTableProblems() []string {
+	var problems []string
+	for _, key := range slices.Sorted(maps.Keys(modelPricing)) {
+		p := modelPricing[key]
+		switch {
+		case p.Cache5mWrite > 0 && p.Cache1hWrite == 0:
+			problems = append(problems, fmt.Sprintf("%s: has a 5m cache write rate but no 1h rate", key))
+		case p.Cache1hWrite < p.Cache5mWrite:
+			problems = append(problems, fmt.Sprintf("%s: 1h cache write rate $%.2f is below the 5m rate $%.2f", key, p.Cache1hWrite, p.Cache5mWrite))
+		}
+	}
+	return problems
+}
+
 // isSonnet4 checks if the model is Sonnet 4 or 4.5
 func isSonnet4(model string) bool {
 	modelLower := strings.ToLower(model)
@@ -158,18 +388,62 @@ func isSonnet4(model string) bool {
 	return strings.Contains(modelLower, "sonnet-4") || strings.Contains(modelLower, "sonnet_4")
 }
 
+// parseModelVersion extracts the major/minor version from a model identifier.
+// Handles both naming schemes: claude-haiku-4-5-20251001 and claude-3-5-haiku-20241022,
+// as well as dotted versions (haiku-4.5). Date suffixes (8-digit tokens) are ignored.
+// Returns ok=false if no version token is found.
+func parseModelVersion(model string) (major, minor int, ok bool) {
+	tokens := strings.FieldsFunc(model, func(r rune) bool {
+		return r == '-' || r == '_' || r == '.' || r == '@' || r == ':' || r == '/'
+	})
+
+	found := false
+	for _, tok := range tokens {
+		n, err := strconv.Atoi(tok)
+		if err != nil || len(tok) >= 8 {
+			// Non-numeric token or a date stamp
+			if found {
+				break
+			}
+			continue
+		}
+		if !found {
+			major, found = n, true
+			continue
+		}
+		minor = n
+		break
+	}
+	return major, minor, found
+}
+
 // claude46LongContextGADate is when 1M context became GA for Opus 4.6 and
 // Sonnet 4.6 with no long-context premium. Before this date, >200K tokens
 // incurred a surcharge for these models.
 var claude46LongContextGADate = time.Date(2026, 3, 13, 0, 0, 0, 0, time.UTC)
 
-// GetModelPricing returns pricing for a model by detecting the family.
-// timestamp is used to determine whether long-context pricing applies
+// GetModelPricing returns pricing for a model by detecting the family, at the
+// rates in effect at timestamp (see pricingHistory).
+// timestamp is also used to determine whether long-context pricing applies
 // (before 2026-03-13, Opus 4.6 and Sonnet 4.6 had a >200K surcharge).
 // Returns (pricing, pricingKey, ok)
 func GetModelPricing(model string, usage *UsageInfo, timestamp time.Time) (ModelPricing, string, bool) {
+	pricing, pricingKey, ok := detectModelPricing(model, usage, timestamp)
+	if !ok {
+		return pricing, pricingKey, false
+	}
+	return pricingAt(pricingKey, pricing, timestamp), pricingKey, true
+}
+
+// detectModelPricing maps a model to its pricing key and current rates
+func detectModelPricing(model string, usage *UsageInfo, timestamp time.Time) (ModelPricing, string, bool) {
 	modelLower := strings.ToLower(model)
 
+	// Models added by the pricing config file match by exact name
+	if configPricingKeys[modelLower] {
+		return modelPricing[modelLower], modelLower, true
+	}
+
 	// Check for Fable
 	if strings.Contains(modelLower, "fable") {
 		return modelPricing["fable-5"], "fable-5", true
@@ -221,11 +495,16 @@ func GetModelPricing(model string, usage *UsageInfo, timestamp time.Time) (Model
 
 	// Check for Haiku variants
 	if strings.Contains(modelLower, "haiku") {
-		// Check for specific versions
-		if strings.Contains(modelLower, "4.5") || strings.Contains(modelLower, "4-5") {
+		major, minor, ok := parseModelVersion(modelLower)
+		switch {
+		case !ok:
+			// No version at all - assume the original Haiku 3
+		case major > 4 || (major == 4 && minor >= 5):
+			// Haiku 4.5 and anything newer we don't know about yet
 			return modelPricing["haiku-4.5"], "haiku-4.5", true
-		}
-		if strings.Contains(modelLower, "3.5") || strings.Contains(modelLower, "3-5") {
+		case major == 4:
+			return modelPricing["haiku-4"], "haiku-4", true
+		case major == 3 && minor == 5:
 			return modelPricing["haiku-3.5"], "haiku-3.5", true
 		}
 		// Default to Haiku 3 for older versions or unspecified
@@ -256,6 +535,23 @@ func GetModelPricing(model string, usage *UsageInfo, timestamp time.Time) (Model
 	return ModelPricing{}, "", false
 }
 
+// CacheBreakevenReads returns how many cache reads of a prefix it takes for the
+// 5m cache write premium (Cache5mWrite over Input) to be paid back by the read
+// discount (Input over CacheRead). ok is false if caching never pays off.
+func (p ModelPricing) CacheBreakevenReads() (reads float64, ok bool) {
+	saving := p.Input - p.CacheRead
+	if saving <= 0 {
+		return 0, false
+	}
+	return (p.Cache5mWrite - p.Input) / saving, true
+}
+
+// serviceTierMultipliers scales costs for usage billed under a non-standard
+// service_tier. Tiers not listed (standard, priority, empty) pay list price.
+var serviceTierMultipliers = map[string]float64{
+	"batch": 0.5, // Batch API is billed at 50% of standard rates
+}
+
 // CalculateCost calculates the cost in dollars for a message.
 // timestamp is used to determine whether long-context pricing applies.
 // Returns (cost, inputTokens, outputTokens, cacheReadTokens, cacheWriteTokens, inputCost, outputCost, cacheReadCost, cacheWriteCost, pricingKey).
@@ -295,11 +591,48 @@ func CalculateCost(msg *Message, timestamp time.Time) (float64, int, int, int, i
 	// Output tokens
 	outputCost := float64(usage.OutputTokens) / 1_000_000.0 * pricing.Output
 
+	// Discounted service tiers (e.g. the Batch API) scale every cost; tokens are unchanged
+	if multiplier, ok := serviceTierMultipliers[usage.ServiceTier]; ok {
+		inputCost *= multiplier
+		cacheWriteCost *= multiplier
+		cacheReadCost *= multiplier
+		outputCost *= multiplier
+	}
+
 	totalCost := inputCost + cacheWriteCost + cacheReadCost + outputCost
 
 	return totalCost, usage.InputTokens, usage.OutputTokens, usage.CacheReadInputTokens, cacheWriteTokens, inputCost, outputCost, cacheReadCost, cacheWriteCost, pricingKey
 }
 
+// SplitCacheWrite divides a message's cache writes into 5m and 1h tokens and
+// costs. cacheWriteCost is the combined cost from CalculateCost; the rates are
+// only looked up again when the message wrote to both caches.
+func SplitCacheWrite(msg *Message, timestamp time.Time, cacheWriteCost float64) (tokens5m, tokens1h int, cost5m, cost1h float64) {
+	if msg == nil || msg.Usage == nil || msg.Usage.CacheCreation == nil {
+		return 0, 0, 0, 0
+	}
+	tokens5m = msg.Usage.CacheCreation.Ephemeral5mInputTokens
+	tokens1h = msg.Usage.CacheCreation.Ephemeral1hInputTokens
+	switch {
+	case tokens1h == 0:
+		return tokens5m, tokens1h, cacheWriteCost, 0
+	case tokens5m == 0:
+		return tokens5m, tokens1h, 0, cacheWriteCost
+	}
+
+	pricing, _, ok := GetModelPricing(*msg.Model, msg.Usage, timestamp)
+	if !ok {
+		return tokens5m, tokens1h, 0, 0
+	}
+	cost5m = float64(tokens5m) / 1_000_000.0 * pricing.Cache5mWrite
+	cost1h = float64(tokens1h) / 1_000_000.0 * pricing.Cache1hWrite
+	if multiplier, ok := serviceTierMultipliers[msg.Usage.ServiceTier]; ok {
+		cost5m *= multiplier
+		cost1h *= multiplier
+	}
+	return tokens5m, tokens1h, cost5m, cost1h
+}
+
 // OpenRouter pricing types and caching
 
 // OpenRouterModel represents a model from the OpenRouter API
@@ -0,0 +1,172 @@
+package main
+
+import (
+	"maps"
+	"math"
+	"os"
+	"path/filepath"
+	"slices"
+	"testing"
+	"time"
+)
+
+// checkPricingFixtures prices each fixture with CalculateCost and reports
+// those whose cost or pricing key differs
+func checkPricingFixtures(t *testing.T, fixtures []pricingFixture) {
+	t.Helper()
+	for _, fx := range fixtures {
+		model, usage := fx.Model, fx.Usage
+		cost, _, _, _, _, _, _, _, _, pricingKey := CalculateCost(&Message{Model: &model, Usage: &usage}, fx.Timestamp)
+		if math.Abs(cost-fx.WantCost) > 1e-9 || pricingKey != fx.WantKey {
+			t.Errorf("%s: got $%.6f (%s), want $%.6f (%s)", fx.Name, cost, pricingKey, fx.WantCost, fx.WantKey)
+		}
+	}
+}
+
+// TestHaikuVersionPricing checks Haiku model identifiers resolve to their
+// own version's rates, falling back to Haiku 3 only for unversioned names
+func TestHaikuVersionPricing(t *testing.T) {
+	output := UsageInfo{OutputTokens: 1_000_000}
+	checkPricingFixtures(t, []pricingFixture{
+		{"haiku-4.5 dated", "claude-haiku-4-5-20251001", output, afterLongContextGA, 5.00, "haiku-4.5"},
+		{"haiku-4.5 alias", "claude-haiku-4-5", output, afterLongContextGA, 5.00, "haiku-4.5"},
+		{"haiku-3.5 dated", "claude-3-5-haiku-20241022", output, afterLongContextGA, 4.00, "haiku-3.5"},
+		{"haiku-3.5 alias", "claude-3-5-haiku-latest", output, afterLongContextGA, 4.00, "haiku-3.5"},
+		{"haiku-3 dated", "claude-3-haiku-20240307", output, afterLongContextGA, 1.25, "haiku-3"},
+		// No dated Haiku 4 release exists; the bare name must still not fall to Haiku 3
+		{"haiku-4 bare", "claude-haiku-4", output, afterLongContextGA, 5.00, "haiku-4"},
+		{"haiku unversioned", "claude-haiku", output, afterLongContextGA, 1.25, "haiku-3"},
+	})
+}
+
+// TestPricingTableProblems checks the shipped pricing table is consistent and
+// that inconsistent cache write rates are caught
+func TestPricingTableProblems(t *testing.T) {
+	if problems := pricingTableProblems(); len(problems) > 0 {
+		t.Errorf("shipped pricing table has problems: %q", problems)
+	}
+
+	defer func(pricing map[string]ModelPricing) { modelPricing = pricing }(maps.Clone(modelPricing))
+	modelPricing = map[string]ModelPricing{
+		"no-1h":       {Input: 1, Cache5mWrite: 1.25, CacheRead: 0.1, Output: 5},
+		"1h-below-5m": {Input: 1, Cache5mWrite: 1.25, Cache1hWrite: 1, CacheRead: 0.1, Output: 5},
+		"no-writes":   {Input: 1, CacheRead: 0.1, Output: 5},
+	}
+	want := []string{
+		"1h-below-5m: 1h cache write rate $1.00 is below the 5m rate $1.25",
+		"no-1h: has a 5m cache write rate but no 1h rate",
+	}
+	if problems := pricingTableProblems(); !slices.Equal(problems, want) {
+		t.Errorf("got problems %q, want %q", problems, want)
+	}
+}
+
+// TestServiceTierPricing checks the batch tier bills every token type at 50%
+// while standard and missing tiers pay list price
+func TestServiceTierPricing(t *testing.T) {
+	checkPricingFixtures(t, []pricingFixture{
+		{"haiku-4.5 standard tier", "claude-haiku-4-5-20251001", UsageInfo{OutputTokens: 1_000_000, ServiceTier: "standard"}, afterLongContextGA, 5.00, "haiku-4.5"},
+		{"haiku-4.5 batch tier", "claude-haiku-4-5-20251001", UsageInfo{OutputTokens: 1_000_000, ServiceTier: "batch"}, afterLongContextGA, 2.50, "haiku-4.5"},
+		{"haiku-4.5 missing tier", "claude-haiku-4-5-20251001", UsageInfo{OutputTokens: 1_000_000}, afterLongContextGA, 5.00, "haiku-4.5"},
+		{"opus-4.5 batch mixed", "claude-opus-4-5-20251101", UsageInfo{InputTokens: 1_000_000, CacheReadInputTokens: 1_000_000, CacheCreation: &CacheCreationInfo{Ephemeral5mInputTokens: 1_000_000}, ServiceTier: "batch"}, afterLongContextGA, 5.875, "opus-4.5"},
+		{"sonnet-4.5 batch long-context", "claude-sonnet-4-5-20250929", UsageInfo{InputTokens: 300_000, ServiceTier: "batch"}, afterLongContextGA, 0.90, "sonnet-longcontext"},
+	})
+}
+
+// TestPricingOverrideEffectiveFrom loads dated rates from the pricing config
+// and checks usage on each side of every price change gets its own rate
+func TestPricingOverrideEffectiveFrom(t *testing.T) {
+	pricing, history, keys := maps.Clone(modelPricing), maps.Clone(pricingHistory), maps.Clone(configPricingKeys)
+	reset := func() {
+		modelPricing, pricingHistory, configPricingKeys = maps.Clone(pricing), maps.Clone(history), maps.Clone(keys)
+	}
+	defer reset()
+
+	path := filepath.Join(t.TempDir(), "pricing.json")
+	if err := os.WriteFile(path, []byte(`{
+		"haiku-4.5": [{"output": 4, "effective_from": "2026-05-01"}, {"output": 3, "effective_from": "2026-06-01"}],
+		"my-model": [{"input": 1, "output": 8}, {"output": 6, "effective_from": "2026-05-01"}]
+	}`), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := LoadPricingOverrides(path); err != nil {
+		t.Fatal(err)
+	}
+
+	may, june := time.Date(2026, 5, 1, 0, 0, 0, 0, time.UTC), time.Date(2026, 6, 1, 0, 0, 0, 0, time.UTC)
+	output := UsageInfo{OutputTokens: 1_000_000}
+	checkPricingFixtures(t, []pricingFixture{
+		{"built-in rate before first change", "claude-haiku-4-5-20251001", output, may.Add(-time.Second), 5.00, "haiku-4.5"},
+		{"first change", "claude-haiku-4-5-20251001", output, may, 4.00, "haiku-4.5"},
+		{"just before second change", "claude-haiku-4-5-20251001", output, june.Add(-time.Second), 4.00, "haiku-4.5"},
+		{"second change", "claude-haiku-4-5-20251001", output, june, 3.00, "haiku-4.5"},
+		{"unchanged field keeps its rate", "claude-haiku-4-5-20251001", UsageInfo{InputTokens: 1_000_000}, june, 1.00, "haiku-4.5"},
+		{"config model base rate", "my-model", output, may.Add(-time.Second), 8.00, "my-model"},
+		{"config model change", "my-model", output, may, 6.00, "my-model"},
+		{"config model change keeps input", "my-model", UsageInfo{InputTokens: 1_000_000}, may, 1.00, "my-model"},
+	})
+
+	for _, bad := range []string{
+		`{"haiku-4.5": [{"output": 4, "effective_from": "2026-06-01"}, {"output": 3, "effective_from": "2026-05-01"}]}`,
+		`{"haiku-4.5": [{"output": 4, "effective_from": "2026-05-01"}, {"output": 3, "effective_from": "2026-05-01"}]}`,
+		`{"haiku-4.5": [{"output": 4}, {"output": 3}]}`,
+		`{"new-model": [{"output": 3, "effective_from": "2026-05-01"}]}`,
+		`{"haiku-4.5": [{"output": 4, "effective_from": "May 2026"}]}`,
+		`{"haiku-4.5": []}`,
+	} {
+		reset()
+		if err := os.WriteFile(path, []byte(bad), 0644); err != nil {
+			t.Fatal(err)
+		}
+		if _, err := LoadPricingOverrides(path); err == nil {
+			t.Errorf("accepted invalid config %s", bad)
+		}
+	}
+}
+
+// TestPricingOverrideKeyCase checks config keys match model names regardless
+// of case, as detectModelPricing lowercases the model before looking it up
+func TestPricingOverrideKeyCase(t *testing.T) {
+	defer func(pricing map[string]ModelPricing, keys map[string]bool) {
+		modelPricing, configPricingKeys = pricing, keys
+	}(maps.Clone(modelPricing), maps.Clone(configPricingKeys))
+
+	path := filepath.Join(t.TempDir(), "pricing.json")
+	if err := os.WriteFile(path, []byte(`{"My-Model": {"output": 4}, "Opus-4.8": {"output": 20}}`), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := LoadPricingOverrides(path); err != nil {
+		t.Fatal(err)
+	}
+	checkPricingFixtures(t, []pricingFixture{
+		{"config model", "my-model", UsageInfo{OutputTokens: 1_000_000}, afterLongContextGA, 4.00, "my-model"},
+		{"config model, other case", "MY-MODEL", UsageInfo{OutputTokens: 1_000_000}, afterLongContextGA, 4.00, "my-model"},
+		{"overridden built-in", "claude-opus-4-8", UsageInfo{OutputTokens: 1_000_000}, afterLongContextGA, 20.00, "opus-4.8"},
+	})
+
+	if err := os.WriteFile(path, []byte(`{"my-model": {"output": 4}, "MY-MODEL": {"output": 5}}`), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := LoadPricingOverrides(path); err == nil {
+		t.Error("keys differing only in case were accepted")
+	}
+}
+
+// TestUpgradeSavings checks savings price both models from the same tokens,
+// with 1h cache writes at the 1h rates and the batch discount on both sides
+func TestUpgradeSavings(t *testing.T) {
+	var m Metrics
+	m.AddRecord(CostRecord{PricingKey: "opus", FullTimestamp: afterLongContextGA, ServiceTier: "batch",
+		InputTokens: 1_000_000, CacheWriteTokens: 2_000_000, CacheWrite5mTokens: 1_000_000, CacheWrite1hTokens: 1_000_000})
+	m.AddRecord(CostRecord{PricingKey: "opus", FullTimestamp: afterLongContextGA, OutputTokens: 1_000_000})
+
+	// opus -> opus-4.8: input $15 -> $5, 5m writes $18.75 -> $6.25, 1h writes
+	// $30 -> $10, all halved for batch; output $75 -> $25 at list price
+	successor, savings, ok := UpgradeSavings("opus", m)
+	if !ok || successor != "opus-4.8" || math.Abs(savings-(0.5*(10+12.5+20)+50)) > 1e-9 {
+		t.Errorf("got %s saves $%.4f (ok %v), want opus-4.8 saves $71.25", successor, savings, ok)
+	}
+	if _, _, ok := UpgradeSavings("opus-4.8", m); ok {
+		t.Error("opus-4.8 has no successor but UpgradeSavings reported one")
+	}
+}
@@ -0,0 +1,40 @@
+package main
+
+import (
+	"math"
+	"testing"
+	"time"
+)
+
+// TestProjectMonthEnd checks the projection and its likely range for steady
+// and uneven daily spend
+func TestProjectMonthEnd(t *testing.T) {
+	now := time.Date(2026, 4, 10, 15, 0, 0, 0, time.UTC)
+	day := func(d int, cost float64) CostRecord {
+		return CostRecord{Timestamp: time.Date(2026, 4, d, 0, 0, 0, 0, time.UTC).Format("2006-01-02"), Cost: cost}
+	}
+
+	var steady []CostRecord
+	for d := 1; d <= 10; d++ {
+		steady = append(steady, day(d, 2))
+	}
+	if p := projectMonthEnd(steady, now, "linear"); math.Abs(p.Cost-60) > 1e-9 || p.Low != p.Cost || p.High != p.Cost {
+		t.Errorf("steady linear: got %+v, want $60 with no spread", p)
+	}
+
+	// Days 4-10 cost $4, $0, $4, $0, $4, $0, $2 (mean $2, sample variance 4),
+	// after a $100 spike on day 1 that only the month-to-date total includes
+	uneven := []CostRecord{day(1, 100), day(4, 4), day(6, 4), day(8, 4), day(10, 2)}
+	p := projectMonthEnd(uneven, now, "trailing7")
+	band := math.Sqrt(4.0 * 20)
+	if want := 114.0 + 2*20; math.Abs(p.Cost-want) > 1e-9 || math.Abs(p.High-(want+band)) > 1e-9 || math.Abs(p.Low-(want-band)) > 1e-9 {
+		t.Errorf("uneven trailing7: got %+v, want $%.2f ± $%.2f", p, want, band)
+	}
+
+	if got := projectionWindowStart(now, "trailing30"); !got.Equal(time.Date(2026, 3, 12, 0, 0, 0, 0, time.UTC)) {
+		t.Errorf("trailing30 window starts %s, want 2026-03-12", got.Format("2006-01-02"))
+	}
+	if got := projectionWindowStart(now, "trailing7"); !got.Equal(time.Date(2026, 4, 1, 0, 0, 0, 0, time.UTC)) {
+		t.Errorf("trailing7 window starts %s, want the month start", got.Format("2006-01-02"))
+	}
+}
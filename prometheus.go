@@ -0,0 +1,103 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+)
+
+// prometheusLabelName converts a table column header into a Prometheus label name
+// (e.g. "Branch Prefix" -> "branch_prefix")
+func prometheusLabelName(column string) string {
+	var b strings.Builder
+	for _, r := range strings.ToLower(column) {
+		if (r >= 'a' && r <= 'z') || (r >= '0' && r <= '9') || r == '_' {
+			b.WriteRune(r)
+		} else {
+			b.WriteRune('_')
+		}
+	}
+	return b.String()
+}
+
+// escapePrometheusLabelValue escapes a label value per the text exposition format
+func escapePrometheusLabelValue(value string) string {
+	value = strings.ReplaceAll(value, `\`, `\\`)
+	value = strings.ReplaceAll(value, `"`, `\"`)
+	return strings.ReplaceAll(value, "\n", `\n`)
+}
+
+// renderPrometheus writes per-group metrics in the Prometheus text exposition
+// format, suitable for the node_exporter textfile collector or a Pushgateway.
+// Group labels become Prometheus labels; each token type is a "type" label.
+func renderPrometheus(w io.Writer, cfg GroupConfig, keys []string, metricsByGroup map[string]Metrics) {
+	labelNames := make([]string, len(cfg.LabelColumns))
+	for i, col := range cfg.LabelColumns {
+		labelNames[i] = prometheusLabelName(col)
+	}
+
+	// Build the label set for each key once
+	labelSets := make(map[string]string, len(keys))
+	for _, key := range keys {
+		var pairs []string
+		for i, label := range cfg.ParseGroupKey(key) {
+			if i < len(labelNames) {
+				pairs = append(pairs, fmt.Sprintf(`%s="%s"`, labelNames[i], escapePrometheusLabelValue(label)))
+			}
+		}
+		labelSets[key] = strings.Join(pairs, ",")
+	}
+
+	type sample struct {
+		typ    string
+		tokens int
+		cost   float64
+	}
+	samplesFor := func(m Metrics) []sample {
+		return []sample{
+			{"input", m.InputTokens, m.InputCost},
+			{"output", m.OutputTokens, m.OutputCost},
+			{"cache_read", m.CacheReadTokens, m.CacheReadCost},
+			{"cache_write", m.CacheWriteTokens, m.CacheWriteCost},
+		}
+	}
+
+	fmt.Fprintln(w, "# HELP ccc_cost_dollars Cost in US dollars by group and token type.")
+	fmt.Fprintln(w, "# TYPE ccc_cost_dollars gauge")
+	for _, key := range keys {
+		for _, s := range samplesFor(metricsByGroup[key]) {
+			fmt.Fprintf(w, "ccc_cost_dollars{%s,type=\"%s\"} %g\n", labelSets[key], s.typ, s.cost)
+		}
+	}
+
+	fmt.Fprintln(w, "# HELP ccc_tokens Token count by group and token type.")
+	fmt.Fprintln(w, "# TYPE ccc_tokens gauge")
+	for _, key := range keys {
+		for _, s := range samplesFor(metricsByGroup[key]) {
+			fmt.Fprintf(w, "ccc_tokens{%s,type=\"%s\"} %d\n", labelSets[key], s.typ, s.tokens)
+		}
+	}
+}
+
+// pushToGateway POSTs an exposition-format body to a Prometheus Pushgateway
+// under <gateway>/metrics/job/<job>.
+func pushToGateway(gateway, job string, body []byte) error {
+	pushURL := strings.TrimSuffix(gateway, "/") + "/metrics/job/" + url.PathEscape(job)
+
+	client := &http.Client{Timeout: 30 * time.Second}
+	resp, err := client.Post(pushURL, "text/plain; version=0.0.4", bytes.NewReader(body))
+	if err != nil {
+		return fmt.Errorf("pushing to %s: %w", pushURL, err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		msg, _ := io.ReadAll(io.LimitReader(resp.Body, 512))
+		return fmt.Errorf("pushgateway returned status %d: %s", resp.StatusCode, strings.TrimSpace(string(msg)))
+	}
+	return nil
+}
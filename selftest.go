@@ -0,0 +1,92 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"math"
+	"time"
+)
+
+// pricingFixture is a known usage object with its expected cost
+type pricingFixture struct {
+	Name      string
+	Model     string
+	Usage     UsageInfo
+	Timestamp time.Time
+	WantCost  float64
+	WantKey   string
+}
+
+var (
+	beforeLongContextGA = time.Date(2026, 1, 15, 12, 0, 0, 0, time.UTC)
+	afterLongContextGA  = time.Date(2026, 4, 15, 12, 0, 0, 0, time.UTC)
+)
+
+// pricingFixtures are golden values for the -self-test mode. Expected costs are
+// worked out by hand from the published per-million-token rates, so any edit to
+// modelPricing or the family detection that changes them will be caught.
+var pricingFixtures = []pricingFixture{
+	// One fixture per family, each exercising a different token type
+	{"opus-4.8 input", "claude-opus-4-8", UsageInfo{InputTokens: 1_000_000}, afterLongContextGA, 5.00, "opus-4.8"},
+	{"opus-4.8 fast output", "claude-opus-4-8", UsageInfo{OutputTokens: 1_000_000, Speed: "fast"}, afterLongContextGA, 50.00, "opus-4.8-fast"},
+	{"opus-4.7 output", "claude-opus-4-7", UsageInfo{OutputTokens: 1_000_000}, afterLongContextGA, 25.00, "opus-4.7"},
+	{"fable-5 input", "claude-fable-5", UsageInfo{InputTokens: 1_000_000}, afterLongContextGA, 10.00, "fable-5"},
+	{"opus-4.6 input", "claude-opus-4-6", UsageInfo{InputTokens: 100_000}, afterLongContextGA, 0.50, "opus-4.6"},
+	{"opus-4.5 output", "claude-opus-4-5-20251101", UsageInfo{OutputTokens: 1_000_000}, afterLongContextGA, 25.00, "opus-4.5"},
+	{"opus legacy output", "claude-opus-4-1-20250805", UsageInfo{OutputTokens: 1_000_000}, afterLongContextGA, 75.00, "opus"},
+	{"sonnet cache read", "claude-sonnet-4-5-20250929", UsageInfo{CacheReadInputTokens: 100_000}, afterLongContextGA, 0.03, "sonnet"},
+	{"haiku-4.5 output", "claude-haiku-4-5-20251001", UsageInfo{OutputTokens: 1_000_000}, afterLongContextGA, 5.00, "haiku-4.5"},
+	{"haiku-3.5 cache read", "claude-3-5-haiku-20241022", UsageInfo{CacheReadInputTokens: 1_000_000}, afterLongContextGA, 0.08, "haiku-3.5"},
+	{"haiku-3 output", "claude-3-haiku-20240307", UsageInfo{OutputTokens: 1_000_000}, afterLongContextGA, 1.25, "haiku-3"},
+	{"deepseek-v4-pro output", "deepseek-v4-pro", UsageInfo{OutputTokens: 1_000_000}, afterLongContextGA, 0.87, "deepseek-v4-pro"},
+	{"deepseek-v4-flash input", "deepseek-v4-flash", UsageInfo{InputTokens: 1_000_000}, afterLongContextGA, 0.14, "deepseek-v4-flash"},
+	{"mimo-v2.5-pro input", "mimo-v2.5-pro", UsageInfo{InputTokens: 1_000_000}, afterLongContextGA, 0.435, "mimo-v2.5-pro"},
+	{"glm-5.2 output", "glm-5.2", UsageInfo{OutputTokens: 1_000_000}, afterLongContextGA, 4.40, "glm-5.2"},
+
+	// 200K long-context threshold: exactly 200K is standard, one more is premium
+	{"sonnet-4.5 at 200K", "claude-sonnet-4-5-20250929", UsageInfo{InputTokens: 200_000}, afterLongContextGA, 0.60, "sonnet"},
+	{"sonnet-4.5 over 200K", "claude-sonnet-4-5-20250929", UsageInfo{InputTokens: 200_001}, afterLongContextGA, 1.200006, "sonnet-longcontext"},
+	{"sonnet-4.5 over 200K via cache", "claude-sonnet-4-5-20250929", UsageInfo{InputTokens: 1, CacheReadInputTokens: 200_000}, afterLongContextGA, 0.000006 + 0.12, "sonnet-longcontext"},
+	{"sonnet-4.6 over 200K before GA", "claude-sonnet-4-6", UsageInfo{InputTokens: 300_000}, beforeLongContextGA, 1.80, "sonnet-longcontext"},
+	{"sonnet-4.6 over 200K after GA", "claude-sonnet-4-6", UsageInfo{InputTokens: 300_000}, afterLongContextGA, 0.90, "sonnet"},
+	{"opus-4.6 over 200K before GA", "claude-opus-4-6", UsageInfo{InputTokens: 300_000}, beforeLongContextGA, 3.00, "opus-4.6-longcontext"},
+	{"opus-4.6 over 200K after GA", "claude-opus-4-6", UsageInfo{InputTokens: 300_000}, afterLongContextGA, 1.50, "opus-4.6"},
+
+	// 5m and 1h cache writes are priced separately
+	{"haiku-4.5 5m cache write", "claude-haiku-4-5-20251001", UsageInfo{CacheCreation: &CacheCreationInfo{Ephemeral5mInputTokens: 1_000_000}}, afterLongContextGA, 1.25, "haiku-4.5"},
+	{"haiku-4.5 1h cache write", "claude-haiku-4-5-20251001", UsageInfo{CacheCreation: &CacheCreationInfo{Ephemeral1hInputTokens: 1_000_000}}, afterLongContextGA, 2.00, "haiku-4.5"},
+	{"opus-4.5 1h cache write", "claude-opus-4-5-20251101", UsageInfo{CacheCreation: &CacheCreationInfo{Ephemeral1hInputTokens: 1_000_000}}, afterLongContextGA, 10.00, "opus-4.5"},
+	{"opus legacy 1h cache write", "claude-opus-4-1-20250805", UsageInfo{CacheCreation: &CacheCreationInfo{Ephemeral1hInputTokens: 1_000_000}}, afterLongContextGA, 30.00, "opus"},
+	{"sonnet-4.5 long-context 1h write", "claude-sonnet-4-5-20250929", UsageInfo{CacheCreationInputTokens: 300_000, CacheCreation: &CacheCreationInfo{Ephemeral1hInputTokens: 300_000}}, afterLongContextGA, 3.60, "sonnet-longcontext"},
+	{"opus-4.5 mixed cache write", "claude-opus-4-5-20251101", UsageInfo{CacheCreation: &CacheCreationInfo{Ephemeral5mInputTokens: 1_000_000, Ephemeral1hInputTokens: 1_000_000}}, afterLongContextGA, 16.25, "opus-4.5"},
+
+	// Zero usage costs nothing but still resolves a family
+	{"sonnet zero usage", "claude-sonnet-4-5-20250929", UsageInfo{}, afterLongContextGA, 0.00, "sonnet"},
+}
+
+// runSelfTest runs CalculateCost against pricingFixtures and reports pass/fail
+// for each, then checks the pricing table. Returns true if everything passes.
+func runSelfTest(w io.Writer) bool {
+	failures := 0
+	for _, fx := range pricingFixtures {
+		model := fx.Model
+		usage := fx.Usage
+		cost, _, _, _, _, _, _, _, _, pricingKey := CalculateCost(&Message{Model: &model, Usage: &usage}, fx.Timestamp)
+
+		if math.Abs(cost-fx.WantCost) > 1e-9 || pricingKey != fx.WantKey {
+			failures++
+			fmt.Fprintf(w, "FAIL  %-32s got $%.6f (%s), want $%.6f (%s)\n", fx.Name, cost, pricingKey, fx.WantCost, fx.WantKey)
+			continue
+		}
+		fmt.Fprintf(w, "ok    %-32s $%.6f (%s)\n", fx.Name, cost, pricingKey)
+	}
+
+	fmt.Fprintf(w, "\n%d/%d pricing fixtures passed\n", len(pricingFixtures)-failures, len(pricingFixtures))
+
+	problems := pricingTableProblems()
+	for _, problem := range problems {
+		fmt.Fprintf(w, "FAIL  pricing table: %s\n", problem)
+	}
+
+	return failures == 0 && len(problems) == 0
+}
@@ -0,0 +1,36 @@
+package main
+
+import (
+	"fmt"
+	"math/rand/v2"
+	"testing"
+)
+
+// benchmarkSortKeys sorts 10k shuffled group keys for grouping on each
+// iteration. Run with: go test -run '^$' -bench SortKeys
+func benchmarkSortKeys(b *testing.B, grouping string, key func(i int) string) {
+	cfg := getGroupConfig(grouping)
+	keys := make([]string, 10_000)
+	for i := range keys {
+		keys[i] = key(i)
+	}
+	rand.New(rand.NewPCG(1, 2)).Shuffle(len(keys), func(i, j int) { keys[i], keys[j] = keys[j], keys[i] })
+
+	work := make([]string, len(keys))
+	for b.Loop() {
+		copy(work, keys)
+		sortKeys(work, cfg)
+	}
+}
+
+func BenchmarkSortKeysCwd(b *testing.B) {
+	benchmarkSortKeys(b, "cwd", func(i int) string {
+		return fmt.Sprintf("/home/u/src/project-%05d", i)
+	})
+}
+
+func BenchmarkSortKeysCwdSession(b *testing.B) {
+	benchmarkSortKeys(b, "cwd,session", func(i int) string {
+		return joinGroupKey(fmt.Sprintf("/home/u/src/project-%03d", i%100), fmt.Sprintf("session-%05d", i))
+	})
+}
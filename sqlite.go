@@ -0,0 +1,111 @@
+package main
+
+import (
+	"database/sql"
+	"fmt"
+	"time"
+
+	_ "modernc.org/sqlite"
+)
+
+// sqliteSchema creates the records table used by -export-sqlite
+const sqliteSchema = `CREATE TABLE IF NOT EXISTS records (
+	uuid               TEXT PRIMARY KEY,
+	request_id         TEXT,
+	timestamp          TEXT NOT NULL,
+	model              TEXT NOT NULL,
+	input_tokens       INTEGER NOT NULL,
+	output_tokens      INTEGER NOT NULL,
+	cache_read_tokens  INTEGER NOT NULL,
+	cache_write_tokens INTEGER NOT NULL,
+	input_cost         REAL NOT NULL,
+	output_cost        REAL NOT NULL,
+	cache_read_cost    REAL NOT NULL,
+	cache_write_cost   REAL NOT NULL,
+	cost               REAL NOT NULL,
+	cwd                TEXT,
+	branch             TEXT,
+	session_id         TEXT,
+	tier               TEXT,
+	source             TEXT
+)`
+
+// sqliteUpsert inserts a record, replacing any existing row with the same UUID
+const sqliteUpsert = `INSERT INTO records (
+	uuid, request_id, timestamp, model,
+	input_tokens, output_tokens, cache_read_tokens, cache_write_tokens,
+	input_cost, output_cost, cache_read_cost, cache_write_cost, cost,
+	cwd, branch, session_id, tier, source
+) VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)
+ON CONFLICT(uuid) DO UPDATE SET
+	request_id = excluded.request_id,
+	timestamp = excluded.timestamp,
+	model = excluded.model,
+	input_tokens = excluded.input_tokens,
+	output_tokens = excluded.output_tokens,
+	cache_read_tokens = excluded.cache_read_tokens,
+	cache_write_tokens = excluded.cache_write_tokens,
+	input_cost = excluded.input_cost,
+	output_cost = excluded.output_cost,
+	cache_read_cost = excluded.cache_read_cost,
+	cache_write_cost = excluded.cache_write_cost,
+	cost = excluded.cost,
+	cwd = excluded.cwd,
+	branch = excluded.branch,
+	session_id = excluded.session_id,
+	tier = excluded.tier,
+	source = excluded.source`
+
+// exportSQLite writes one row per deduplicated record into the records table
+// of the SQLite database at path, creating it if needed. Rows are upserted by
+// UUID so re-running the export is idempotent. Records without a UUID are
+// skipped. Returns the number of rows written.
+func exportSQLite(path string, records []CostRecord) (int, error) {
+	db, err := sql.Open("sqlite", path)
+	if err != nil {
+		return 0, fmt.Errorf("opening %s: %w", path, err)
+	}
+	defer db.Close()
+
+	if _, err := db.Exec(sqliteSchema); err != nil {
+		return 0, fmt.Errorf("creating records table: %w", err)
+	}
+
+	tx, err := db.Begin()
+	if err != nil {
+		return 0, err
+	}
+	defer tx.Rollback()
+
+	stmt, err := tx.Prepare(sqliteUpsert)
+	if err != nil {
+		return 0, fmt.Errorf("preparing upsert: %w", err)
+	}
+	defer stmt.Close()
+
+	written := 0
+	for _, r := range records {
+		if r.UUID == "" {
+			continue
+		}
+		var requestID sql.NullString
+		if r.RequestID != nil {
+			requestID = sql.NullString{String: *r.RequestID, Valid: true}
+		}
+		_, err := stmt.Exec(
+			r.UUID, requestID, r.FullTimestamp.UTC().Format(time.RFC3339Nano), r.PricingKey,
+			r.InputTokens, r.OutputTokens, r.CacheReadTokens, r.CacheWriteTokens,
+			r.InputCost, r.OutputCost, r.CacheReadCost, r.CacheWriteCost, r.Cost,
+			r.Cwd, r.GitBranch, r.SessionID, r.ServiceTier, r.Source,
+		)
+		if err != nil {
+			return written, fmt.Errorf("writing record %s: %w", r.UUID, err)
+		}
+		written++
+	}
+
+	if err := tx.Commit(); err != nil {
+		return written, err
+	}
+	return written, nil
+}
@@ -0,0 +1,122 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"maps"
+	"slices"
+	"strings"
+	"testing"
+)
+
+// TestTokenDecimalsColumnAlignment renders a table at several -token-decimals
+// precisions and checks every breakdown cell is exactly as wide as
+// calculateColumnWidths says, so tokens and costs line up down each column
+func TestTokenDecimalsColumnAlignment(t *testing.T) {
+	defer func(decimals int, nc bool) { tokenDecimals, noColor = decimals, nc }(tokenDecimals, noColor)
+	noColor = true
+
+	metricsByGroup := map[string]Metrics{
+		"2026-04-14": {InputTokens: 999, OutputTokens: 1_234, CacheReadTokens: 12_345_678, CacheWriteTokens: 0,
+			InputCost: 0.01, OutputCost: 0.03, CacheReadCost: 3.70, Cost: 3.74},
+		"2026-04-15": {InputTokens: 45_600, OutputTokens: 987_654, CacheReadTokens: 1_500, CacheWriteTokens: 2_000_000_000,
+			InputCost: 0.14, OutputCost: 14.81, CacheReadCost: 0.01, CacheWriteCost: 7500, Cost: 7514.96},
+	}
+	keys := []string{"2026-04-14", "2026-04-15"}
+	var total Metrics
+	for _, key := range keys {
+		total.Add(metricsByGroup[key])
+	}
+
+	for _, decimals := range []int{0, 1, 2} {
+		t.Run(fmt.Sprintf("decimals=%d", decimals), func(t *testing.T) {
+			tokenDecimals = decimals
+			widths := calculateColumnWidths(map[string]Metrics{keys[0]: metricsByGroup[keys[0]], keys[1]: metricsByGroup[keys[1]], "__total__": total})
+
+			var buf bytes.Buffer
+			renderTable(&buf, getGroupConfig("day"), keys, metricsByGroup)
+
+			rows := map[string]Metrics{keys[0]: metricsByGroup[keys[0]], keys[1]: metricsByGroup[keys[1]], "Total": total}
+			checked := 0
+			for _, line := range strings.Split(buf.String(), "\n") {
+				fields := strings.Split(line, "│")
+				if len(fields) != 8 { // Borders around Date, 4 breakdown columns and Total
+					continue
+				}
+				m, ok := rows[strings.TrimSpace(fields[1])]
+				if !ok {
+					continue
+				}
+				checked++
+
+				want := []string{
+					fmt.Sprintf("%*s  %*s", widths.InputTokenWidth, formatTokens(m.InputTokens), widths.InputCostWidth, formatCost(m.InputCost)),
+					fmt.Sprintf("%*s  %*s", widths.OutputTokenWidth, formatTokens(m.OutputTokens), widths.OutputCostWidth, formatCost(m.OutputCost)),
+					fmt.Sprintf("%*s  %*s", widths.CacheReadTokenWidth, formatTokens(m.CacheReadTokens), widths.CacheReadCostWidth, formatCost(m.CacheReadCost)),
+					fmt.Sprintf("%*s  %*s", widths.CacheWriteTokenWidth, formatTokens(m.CacheWriteTokens), widths.CacheWriteCostWidth, formatCost(m.CacheWriteCost)),
+				}
+				cellWidths := []int{widths.InputCellWidth, widths.OutputCellWidth, widths.CacheReadCellWidth, widths.CacheWriteCellWidth}
+				for i, cell := range fields[2:6] {
+					// Cells are right-aligned with one space of padding each side
+					content := strings.TrimSuffix(cell, " ")
+					if len(want[i]) != cellWidths[i] {
+						t.Errorf("%s column %d: cell %q is %d wide, widths say %d", fields[1], i, want[i], len(want[i]), cellWidths[i])
+					}
+					if !strings.HasSuffix(content, " "+want[i]) {
+						t.Errorf("%s column %d: rendered %q, want it to end with %q", fields[1], i, content, want[i])
+					}
+				}
+			}
+			if checked != len(rows) {
+				t.Fatalf("found %d of %d rows in output:\n%s", checked, len(rows), buf.String())
+			}
+		})
+	}
+}
+
+// TestLongContextAnnotations checks premium-tier request counts land on the
+// base model's row, not on the -longcontext row that already names the tier
+func TestLongContextAnnotations(t *testing.T) {
+	got := longContextAnnotations(map[string]Metrics{
+		"sonnet":               {Requests: 10},
+		"sonnet-longcontext":   {Requests: 3, LongContext: 3},
+		"opus-4.6-longcontext": {Requests: 2, LongContext: 2}, // No base row
+		"haiku-4.5":            {Requests: 5},
+	})
+	if want := map[string]string{"sonnet": "(3 long-ctx)"}; !maps.Equal(got, want) {
+		t.Errorf("got annotations %q, want %q", got, want)
+	}
+}
+
+// TestRenderVerticalMatchesTable checks the narrow-terminal vertical layout
+// keeps the trailing columns and hierarchical subtotals the table would show
+func TestRenderVerticalMatchesTable(t *testing.T) {
+	defer func(pct, cum bool, nc bool) { showPct, cumulative, noColor = pct, cum, nc }(showPct, cumulative, noColor)
+	showPct, cumulative, noColor = true, true, true
+
+	metricsByGroup := map[string]Metrics{
+		"2026-04-14": {OutputTokens: 1_000, OutputCost: 1, Cost: 1},
+		"2026-04-15": {OutputTokens: 3_000, OutputCost: 3, Cost: 3},
+	}
+	keys := []string{"2026-04-14", "2026-04-15"}
+	var buf bytes.Buffer
+	renderVertical(&buf, getGroupConfig("day"), keys, metricsByGroup, Metrics{OutputTokens: 4_000, OutputCost: 4, Cost: 4})
+	// Compare with runs of spaces collapsed: padding depends on the widest name
+	got := strings.Join(strings.Fields(buf.String()), " ")
+	for _, want := range []string{"% of Total: 25.0%", "% of Total: 75.0%", "Cumulative: $4.00", "Total Input:"} {
+		if !strings.Contains(got, want) {
+			t.Errorf("flat vertical output lacks %q:\n%s", want, buf.String())
+		}
+	}
+
+	showPct, cumulative = false, false
+	hier := map[string]Metrics{
+		joinGroupKey("2026-04-14", "opus-4.8"): {OutputTokens: 1_000, OutputCost: 1, Cost: 1},
+		joinGroupKey("2026-04-14", "sonnet"):   {OutputTokens: 2_000, OutputCost: 2, Cost: 2},
+	}
+	buf.Reset()
+	renderVertical(&buf, getGroupConfig("day,model"), slices.Sorted(maps.Keys(hier)), hier, Metrics{OutputTokens: 3_000, OutputCost: 3, Cost: 3})
+	if want := "2026-04-14 / Total\n"; !strings.Contains(buf.String(), want) {
+		t.Errorf("hierarchical vertical output lacks subtotal %q:\n%s", want, buf.String())
+	}
+}
@@ -32,7 +32,9 @@ type Message struct {
 	Usage *UsageInfo `json:"usage,omitempty"`
 }
 
-// UsageInfo represents token usage information
+// UsageInfo represents token usage information.
+// OutputTokens already includes extended-thinking tokens: the API reports no
+// separate thinking count and bills thinking at the output rate.
 type UsageInfo struct {
 	InputTokens              int                `json:"input_tokens"`
 	CacheCreationInputTokens int                `json:"cache_creation_input_tokens"`
@@ -0,0 +1,148 @@
+package main
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"io"
+	"maps"
+	"os"
+	"path/filepath"
+	"slices"
+
+	"github.com/go-json-experiment/json"
+)
+
+// historyFileCheck counts the lines of one history file by outcome
+type historyFileCheck struct {
+	File       string
+	Valid      int   // Lines that parse and sit in the file's time range
+	Corrupt    int   // Lines that don't parse as a log entry
+	Misfiled   int   // Parsed lines timestamped outside the filename's [start,end) range
+	Duplicates int   // Lines repeating a UUID seen earlier in the same file
+	NameErr    error // Why the filename's range couldn't be used, if it couldn't
+}
+
+// uuidCollision is a UUID stored in more than one history file
+type uuidCollision struct {
+	UUID  string
+	Files []string
+}
+
+// verifyResult is the outcome of checking every history file
+type verifyResult struct {
+	Files      []historyFileCheck
+	Collisions []uuidCollision
+}
+
+// OK reports whether no corruption, misfiled records or UUID collisions were
+// found. Stray files whose names aren't history names are reported but not
+// counted as corruption: reads skip them.
+func (r verifyResult) OK() bool {
+	for _, c := range r.Files {
+		if c.Corrupt > 0 || c.Misfiled > 0 || c.Duplicates > 0 || errors.Is(c.NameErr, ErrBadRange) {
+			return false
+		}
+	}
+	return len(r.Collisions) == 0
+}
+
+// verifyHistory parses every line of files, checking that each record's
+// timestamp falls in the range encoded in its filename and that no UUID is
+// stored twice, within a file or across files
+func verifyHistory(files []string) (verifyResult, error) {
+	var result verifyResult
+	fileByUUID := make(map[string]string)
+	collisions := make(map[string][]string)
+
+	for _, file := range slices.Sorted(slices.Values(files)) {
+		check := historyFileCheck{File: file}
+		start, end, nameErr := ParseHistoryFilename(file)
+		check.NameErr = nameErr
+
+		f, err := os.Open(file)
+		if err != nil {
+			return result, err
+		}
+		seen := make(map[string]bool)
+		scanner := bufio.NewScanner(f)
+		scanner.Buffer(make([]byte, 1024*1024), 64*1024*1024)
+		for scanner.Scan() {
+			line := scanner.Bytes()
+			if len(line) == 0 {
+				continue
+			}
+
+			var entry ConversationEntry
+			if err := json.Unmarshal(line, &entry); err != nil {
+				check.Corrupt++
+				continue
+			}
+			if entry.UUID != "" {
+				if seen[entry.UUID] {
+					check.Duplicates++
+					continue
+				}
+				seen[entry.UUID] = true
+				if first, ok := fileByUUID[entry.UUID]; !ok {
+					fileByUUID[entry.UUID] = file
+				} else if first != file {
+					if len(collisions[entry.UUID]) == 0 {
+						collisions[entry.UUID] = []string{first}
+					}
+					collisions[entry.UUID] = append(collisions[entry.UUID], file)
+				}
+			}
+			if nameErr == nil {
+				if ts := entry.Timestamp.Unix(); ts < start || ts >= end {
+					check.Misfiled++
+					continue
+				}
+			}
+			check.Valid++
+		}
+		err = scanner.Err()
+		f.Close()
+		if err != nil {
+			return result, fmt.Errorf("reading %s: %w", file, err)
+		}
+		result.Files = append(result.Files, check)
+	}
+
+	for _, uuid := range slices.Sorted(maps.Keys(collisions)) {
+		result.Collisions = append(result.Collisions, uuidCollision{UUID: uuid, Files: collisions[uuid]})
+	}
+	return result, nil
+}
+
+// printVerifyReport writes per-file line counts, UUID collisions and totals
+func printVerifyReport(w io.Writer, result verifyResult) {
+	var valid, corrupt, misfiled, duplicates int
+	for _, c := range result.Files {
+		valid += c.Valid
+		corrupt += c.Corrupt
+		misfiled += c.Misfiled
+		duplicates += c.Duplicates
+
+		fmt.Fprintf(w, "%s: %d valid, %d corrupt, %d misfiled", filepath.Base(c.File), c.Valid, c.Corrupt, c.Misfiled)
+		if c.Duplicates > 0 {
+			fmt.Fprintf(w, ", %d duplicate", c.Duplicates)
+		}
+		switch {
+		case errors.Is(c.NameErr, ErrBadRange):
+			fmt.Fprintf(w, " (%v)", c.NameErr)
+		case c.NameErr != nil:
+			fmt.Fprintf(w, " (not a history file name, range not checked)")
+		}
+		fmt.Fprintln(w)
+	}
+	for _, c := range result.Collisions {
+		names := make([]string, len(c.Files))
+		for i, file := range c.Files {
+			names[i] = filepath.Base(file)
+		}
+		fmt.Fprintf(w, "UUID %s is in %d files: %v\n", c.UUID, len(c.Files), names)
+	}
+	fmt.Fprintf(w, "Verified %d history files: %d valid, %d corrupt, %d misfiled, %d duplicate lines; %d UUID collisions\n",
+		len(result.Files), valid, corrupt, misfiled, duplicates, len(result.Collisions))
+}